@@ -0,0 +1,187 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hello/scraper/database"
+	"hello/scraper/models"
+	"hello/scraper/scrapers"
+	"log"
+	"os"
+	"sort"
+	"text/tabwriter"
+	"time"
+)
+
+// history prints every version the record of an oid went through, newest first.
+func history(sqlDb *database.SqlDb, args []string) error {
+	if len(args) != 1 {
+		return errors.New("expected a single oid")
+	}
+	oid := models.NormalizeOid(args[0])
+
+	versions, err := sqlDb.History(oid)
+	if err != nil {
+		return err
+	}
+	if len(versions) == 0 {
+		return fmt.Errorf("no record of %v", oid)
+	}
+	if current := versions[0]; !current.TombstonedAt.IsZero() {
+		fmt.Printf("%v is tombstoned: its parent page stopped listing it at %v\n\n", oid, formatTime(current.TombstonedAt))
+	}
+	if details := versions[0].Details; details != nil {
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintf(w, "ASN.1 notation:\t%v\n", orDash(details.ASN1))
+		fmt.Fprintf(w, "OID-IRI:\t%v\n", orDash(details.IRI))
+		fmt.Fprintf(w, "Dot notation:\t%v\n", orDash(details.Dot))
+		fmt.Fprintf(w, "Registration authority:\t%v\n", orDash(details.Authority))
+		fmt.Fprintf(w, "Created:\t%v\n", formatTime(details.Created))
+		fmt.Fprintf(w, "Modified:\t%v\n\n", formatTime(details.Modified))
+		err = w.Flush()
+		if err != nil {
+			return err
+		}
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(w, "FROM\tUNTIL\tRUN\tNAME\tSUB CHILDREN\tSUB NODES TOTAL\tDESCRIPTION\tINFORMATION\n")
+	for _, v := range versions {
+		fmt.Fprintf(w, "%v\t%v\t%v\t%v\t%d\t%d\t%v\t%v\n", formatTime(v.Since), formatTime(v.Until), formatRun(v.RunID),
+			v.Info.Name, v.Info.SubCh, v.Info.SubTotal, shorten(v.Info.Desc), shorten(v.Info.Inf))
+	}
+
+	return w.Flush()
+}
+
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return "-"
+	}
+	return t.Format("2006-01-02 15:04:05")
+}
+
+func orDash(text string) string {
+	if text == "" {
+		return "-"
+	}
+	return text
+}
+
+func formatRun(id int64) string {
+	if id == 0 {
+		return "-"
+	}
+	return fmt.Sprint(id)
+}
+
+// shorten keeps long text columns readable in a table.
+func shorten(text string) string {
+	const max = 60
+	runes := []rune(text)
+	if len(runes) <= max {
+		return text
+	}
+	return string(runes[:max-3]) + "..."
+}
+
+// overdue prints the pages in scope a refresh would fetch again, most overdue first.
+func overdue(sqlDb *database.SqlDb) error {
+	ttl, err := newTTL()
+	if err != nil {
+		return err
+	}
+	pages, err := sqlDb.Overdue(newScope(), ttl)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(w, "OID\tLAST FETCHED\tTTL\tOVERDUE BY\n")
+	for _, page := range pages {
+		fmt.Fprintf(w, "%v\t%v\t%v\t%v\n", page.Oid, formatTime(page.LastFetched), page.TTL.Round(time.Second),
+			now.Sub(page.DueAt).Round(time.Second))
+	}
+	fmt.Fprintf(w, "%d pages overdue\n", len(pages))
+
+	return w.Flush()
+}
+
+// listArchive prints the archived fetches of the page of an oid, newest first.
+func listArchive(sqlDb *database.SqlDb, args []string) error {
+	if len(args) != 1 {
+		return errors.New("expected a single oid")
+	}
+	oid := models.NormalizeOid(args[0])
+
+	pages, err := sqlDb.Archive(oid)
+	if err != nil {
+		return err
+	}
+	if len(pages) == 0 {
+		return fmt.Errorf("no archived page of %v", oid)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(w, "FETCHED\tRUN\tSIZE\tHASH\tURL\n")
+	for _, page := range pages {
+		fmt.Fprintf(w, "%v\t%v\t%d\t%v\t%v\n", formatTime(page.FetchedAt), formatRun(page.RunID), page.Size,
+			page.Hash[:12], page.URL)
+	}
+
+	return w.Flush()
+}
+
+// reparse runs the current parser over the archived pages in scope and
+// prints the records that changed.
+func reparse(ctx context.Context, sqlDb *database.SqlDb, args []string) error {
+	if len(args) > 1 {
+		return errors.New("expected at most one oid")
+	}
+	scope := newScope()
+	if len(args) == 1 {
+		scope = models.NewScope(args, 0, nil)
+	}
+
+	parser := scrapers.NewOIDParser(nil, *agent, nil, scrapers.RetryPolicy{})
+	_, changes, err := scrapers.NewReparser(sqlDb, parser, scope, flagsJSON()).Run(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, change := range []struct {
+		what string
+		oids []string
+	}{{"inserted", changes.Inserted}, {"updated", changes.Updated}, {"tombstoned", changes.Tombstoned}} {
+		sort.Strings(change.oids)
+		for _, oid := range change.oids {
+			fmt.Printf("%v\t%v\n", change.what, oid)
+		}
+	}
+
+	return nil
+}
+
+// importWARC adds the oid pages recorded in WARC files to the archive.
+func importWARC(sqlDb *database.SqlDb, files []string) error {
+	if len(files) == 0 {
+		return errors.New("expected at least one warc file")
+	}
+
+	for _, name := range files {
+		file, err := os.Open(name)
+		if err != nil {
+			return err
+		}
+		imported, skipped, err := scrapers.ImportWARC(sqlDb, file)
+		file.Close()
+		if err != nil {
+			return fmt.Errorf("cant import %v: %v", name, err)
+		}
+		log.Printf("Imported %d pages from %v, skipped %d", imported, name, skipped)
+	}
+
+	return nil
+}
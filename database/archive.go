@@ -0,0 +1,222 @@
+package database
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"hello/scraper/models"
+	"io"
+	"time"
+)
+
+// archivePage keeps the body of page. Bodies are stored gzipped once per
+// content hash, every fetch only adds a row pointing at its body.
+func archivePage(tx *sql.Tx, runID int64, page *models.Page, fetchedAt int64) error {
+	hash, err := storeBody(tx, page.Body)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("INSERT INTO page_archive(oid, url, fetched_at, hash, run_id) values(?,?,?,?,?);",
+		page.Oid, page.URL, fetchedAt, hash, runID)
+	if err != nil {
+		return fmt.Errorf("cant execute an archive query: %v", err)
+	}
+
+	return nil
+}
+
+// ImportPage adds a fetch made elsewhere to the archive. It reports false
+// when the archive already has the same body for the same url and time, so
+// importing a file twice does no harm.
+func (s *SqlDb) ImportPage(page *models.ArchivedPage) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return false, fmt.Errorf("cant begin a transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	hash, err := storeBody(tx, page.Body)
+	if err != nil {
+		return false, err
+	}
+	res, err := tx.Exec("INSERT INTO page_archive(oid, url, fetched_at, hash) SELECT ?,?,?,? WHERE NOT EXISTS "+
+		"(SELECT 1 FROM page_archive WHERE url = ? AND fetched_at = ? AND hash = ?);", page.Oid, page.URL,
+		page.FetchedAt.Unix(), hash, page.URL, page.FetchedAt.Unix(), hash)
+	if err != nil {
+		return false, fmt.Errorf("cant execute an import query: %v", err)
+	}
+	imported, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return false, fmt.Errorf("cant commit an import: %v", err)
+	}
+
+	return imported > 0, nil
+}
+
+// storeBody stores body under its content hash unless it is there already
+// and returns the hash.
+func storeBody(tx *sql.Tx, body []byte) (string, error) {
+	sum := sha256.Sum256(body)
+	hash := hex.EncodeToString(sum[:])
+
+	var exists int
+	err := tx.QueryRow("SELECT count(*) FROM page_blobs WHERE hash = ?;", hash).Scan(&exists)
+	if err != nil {
+		return "", fmt.Errorf("cant look up page blob: %v", err)
+	}
+	if exists > 0 {
+		return hash, nil
+	}
+
+	data, err := compress(body)
+	if err != nil {
+		return "", err
+	}
+	_, err = tx.Exec("INSERT INTO page_blobs(hash, size, data) values(?,?,?);", hash, len(body), data)
+	if err != nil {
+		return "", fmt.Errorf("cant execute a page blob query: %v", err)
+	}
+
+	return hash, nil
+}
+
+// Archive lists the archived fetches of the page of oid, newest first,
+// without their bodies.
+func (s *SqlDb) Archive(oid string) ([]*models.ArchivedPage, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	rows, err := s.db.Query("SELECT a.oid, a.url, a.fetched_at, a.hash, COALESCE(a.run_id, 0), b.size FROM page_archive a "+
+		"JOIN page_blobs b ON b.hash = a.hash WHERE a.oid = ? ORDER BY a.fetched_at DESC, a.id DESC;", oid)
+	if err != nil {
+		return nil, fmt.Errorf("cant execute an archive query: %v", err)
+	}
+	defer rows.Close()
+
+	var pages []*models.ArchivedPage
+	for rows.Next() {
+		page := &models.ArchivedPage{}
+		var fetchedAt int64
+		err = rows.Scan(&page.Oid, &page.URL, &fetchedAt, &page.Hash, &page.RunID, &page.Size)
+		if err != nil {
+			return nil, fmt.Errorf("cant scan an archive row: %v", err)
+		}
+		page.FetchedAt = time.Unix(fetchedAt, 0)
+		pages = append(pages, page)
+	}
+
+	return pages, rows.Err()
+}
+
+// LatestArchived lists the most recent archived fetch of every page scope
+// wants fetched, without their bodies.
+func (s *SqlDb) LatestArchived(scope *models.Scope) ([]*models.ArchivedPage, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	clause, args := scopeClause(scope)
+	rows, err := s.db.Query("SELECT oid, url, fetched_at, a.hash, COALESCE(run_id, 0), b.size FROM page_archive a "+
+		"JOIN page_blobs b ON b.hash = a.hash WHERE "+clause+" AND a.id = (SELECT p.id FROM page_archive p "+
+		"WHERE p.oid = a.oid ORDER BY p.fetched_at DESC, p.id DESC LIMIT 1) ORDER BY oid;", args...)
+	if err != nil {
+		return nil, fmt.Errorf("cant execute an archive query: %v", err)
+	}
+	defer rows.Close()
+
+	var pages []*models.ArchivedPage
+	for rows.Next() {
+		page := &models.ArchivedPage{}
+		var fetchedAt int64
+		err = rows.Scan(&page.Oid, &page.URL, &fetchedAt, &page.Hash, &page.RunID, &page.Size)
+		if err != nil {
+			return nil, fmt.Errorf("cant scan an archive row: %v", err)
+		}
+		page.FetchedAt = time.Unix(fetchedAt, 0)
+		pages = append(pages, page)
+	}
+
+	return pages, rows.Err()
+}
+
+// LatestFetch returns the most recent archived fetch of url with its body, nil
+// when url was never archived.
+func (s *SqlDb) LatestFetch(url string) (*models.ArchivedPage, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	page := &models.ArchivedPage{}
+	var fetchedAt int64
+	var data []byte
+	err := s.db.QueryRow("SELECT a.oid, a.url, a.fetched_at, a.hash, COALESCE(a.run_id, 0), b.size, b.data "+
+		"FROM page_archive a JOIN page_blobs b ON b.hash = a.hash WHERE a.url = ? "+
+		"ORDER BY a.fetched_at DESC, a.id DESC LIMIT 1;", url).
+		Scan(&page.Oid, &page.URL, &fetchedAt, &page.Hash, &page.RunID, &page.Size, &data)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("cant look up archived url %v: %v", url, err)
+	}
+	page.FetchedAt = time.Unix(fetchedAt, 0)
+
+	page.Body, err = decompress(data)
+	if err != nil {
+		return nil, err
+	}
+	return page, nil
+}
+
+// ArchivedBody returns the body stored under hash.
+func (s *SqlDb) ArchivedBody(hash string) ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var data []byte
+	err := s.db.QueryRow("SELECT data FROM page_blobs WHERE hash = ?;", hash).Scan(&data)
+	if err != nil {
+		return nil, fmt.Errorf("cant look up page blob %v: %v", hash, err)
+	}
+
+	return decompress(data)
+}
+
+func compress(body []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	_, err := w.Write(body)
+	if err == nil {
+		err = w.Close()
+	}
+	if err != nil {
+		return nil, fmt.Errorf("cant compress page: %v", err)
+	}
+
+	return buf.Bytes(), nil
+}
+
+func decompress(data []byte) ([]byte, error) {
+	r, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("cant decompress page: %v", err)
+	}
+	defer r.Close()
+
+	body, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("cant decompress page: %v", err)
+	}
+
+	return body, nil
+}
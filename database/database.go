@@ -5,13 +5,18 @@ import (
 	"fmt"
 	"hello/scraper/models"
 	"log"
+	"sort"
+	"strings"
 	"sync"
+	"time"
 )
 
 type DB interface {
 	Prepare(query string) (*sql.Stmt, error)
+	Exec(query string, args ...interface{}) (sql.Result, error)
 	QueryRow(query string, args ...interface{}) *sql.Row
 	Query(query string, args ...interface{}) (*sql.Rows, error)
+	Begin() (*sql.Tx, error)
 	Ping() error
 }
 
@@ -24,137 +29,787 @@ func NewSqlDb(db DB) *SqlDb {
 	return &SqlDb{db: db, mu: &sync.Mutex{}}
 }
 
+// schema is run in order by Prepare, so every statement has to be safe to
+// run against a database that already has it.
+var schema = []string{
+	"CREATE TABLE IF NOT EXISTS mib " +
+		"(uid INTEGER not null constraint mib_pk primary key autoincrement,oid VARCHAR(64) not null," +
+		"name VARCHAR(64) not null,sub_ch INTEGER not null,sub_total INTEGER,descr TEXT," +
+		"inf TEXT default '-')",
+	"CREATE TABLE IF NOT EXISTS frontier (oid VARCHAR(64) not null constraint frontier_pk primary key," +
+		"state VARCHAR(16) not null default 'pending',attempts INTEGER not null default 0,leased_until INTEGER," +
+		"updated_at INTEGER not null,last_error TEXT)",
+	"CREATE INDEX IF NOT EXISTS frontier_state_idx ON frontier (state)",
+	"CREATE TABLE IF NOT EXISTS crawl_runs (id INTEGER not null constraint crawl_runs_pk primary key autoincrement," +
+		"started_at INTEGER not null,ended_at INTEGER,config TEXT,exit_reason VARCHAR(16),pages_fetched INTEGER default 0," +
+		"records_inserted INTEGER default 0,failures INTEGER default 0,released INTEGER default 0)",
+	"CREATE TABLE IF NOT EXISTS mib_history (id INTEGER not null constraint mib_history_pk primary key autoincrement," +
+		"oid VARCHAR(64) not null,name VARCHAR(64) not null,sub_ch INTEGER not null,sub_total INTEGER,descr TEXT," +
+		"inf TEXT,run_id INTEGER REFERENCES crawl_runs(id),replaced_at INTEGER not null," +
+		"replaced_by INTEGER REFERENCES crawl_runs(id))",
+	"CREATE INDEX IF NOT EXISTS mib_history_oid_idx ON mib_history (oid)",
+	"CREATE TABLE IF NOT EXISTS page_blobs (hash CHAR(64) not null constraint page_blobs_pk primary key," +
+		"size INTEGER not null,data BLOB not null)",
+	"CREATE TABLE IF NOT EXISTS page_archive (id INTEGER not null constraint page_archive_pk primary key autoincrement," +
+		"oid VARCHAR(64) not null,url TEXT not null,fetched_at INTEGER not null," +
+		"hash CHAR(64) not null REFERENCES page_blobs(hash),run_id INTEGER REFERENCES crawl_runs(id))",
+	"CREATE INDEX IF NOT EXISTS page_archive_url_idx ON page_archive (url, fetched_at)",
+	"CREATE INDEX IF NOT EXISTS page_archive_oid_idx ON page_archive (oid, fetched_at)",
+}
+
+// columns were added to existing tables after they first shipped.
+var columns = []struct {
+	table      string
+	name       string
+	definition string
+}{
+	{"mib", "run_id", "INTEGER REFERENCES crawl_runs(id)"},
+	{"frontier", "etag", "TEXT"},
+	{"frontier", "last_modified", "TEXT"},
+	{"frontier", "last_fetched", "INTEGER"},
+	{"crawl_runs", "pages_unchanged", "INTEGER default 0"},
+	{"crawl_runs", "records_updated", "INTEGER default 0"},
+	{"frontier", "due_at", "INTEGER"},
+	{"mib", "tombstoned_at", "INTEGER"},
+	{"crawl_runs", "records_tombstoned", "INTEGER default 0"},
+	{"crawl_runs", "bytes_fetched", "INTEGER default 0"},
+	{"mib", "parent", "VARCHAR(64)"},
+	{"mib", "depth", "INTEGER"},
+	{"mib", "name_path", "TEXT"},
+	{"mib", "asn1_notation", "TEXT"},
+	{"mib", "oid_iri", "TEXT"},
+	{"mib", "dot_notation", "VARCHAR(64)"},
+	{"mib", "registration_authority", "TEXT"},
+	{"mib", "registered_at", "INTEGER"},
+	{"mib", "registration_modified_at", "INTEGER"},
+}
+
+// indexes are created once all columns are in place.
+var indexes = []string{
+	"CREATE INDEX IF NOT EXISTS mib_run_idx ON mib (run_id)",
+	"CREATE INDEX IF NOT EXISTS mib_oid_idx ON mib (oid)",
+	"CREATE INDEX IF NOT EXISTS frontier_due_idx ON frontier (state, due_at)",
+	"CREATE INDEX IF NOT EXISTS mib_parent_idx ON mib (parent)",
+	"CREATE INDEX IF NOT EXISTS mib_name_path_idx ON mib (name_path)",
+}
+
 func (s *SqlDb) Prepare() error {
 	err := s.testConnection()
 	if err != nil {
 		return fmt.Errorf("can`t test database: %v", err)
 	}
 
-	stmt, err := s.db.Prepare("CREATE TABLE IF NOT EXISTS mib " +
-		"(uid INTEGER not null constraint mib_pk primary key autoincrement,oid VARCHAR(64) not null," +
-		"name VARCHAR(64) not null,sub_ch INTEGER not null,sub_total INTEGER,descr VARCHAR(100)," +
-		"inf VARCHAR(100) default '-')")
+	for _, query := range schema {
+		_, err = s.db.Exec(query)
+		if err != nil {
+			return fmt.Errorf("cant execute a prepare query: %v", err)
+		}
+	}
+
+	for _, column := range columns {
+		err = s.addColumn(column.table, column.name, column.definition)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = s.widenMibText()
 	if err != nil {
-		return fmt.Errorf("cant prepare a query: %v", err)
+		return err
 	}
 
-	_, err = stmt.Exec()
+	for _, query := range indexes {
+		_, err = s.db.Exec(query)
+		if err != nil {
+			return fmt.Errorf("cant create an index: %v", err)
+		}
+	}
+
+	err = s.backfillTree()
 	if err != nil {
-		return fmt.Errorf("cant execute a prepare query: %v", err)
+		return err
 	}
 
-	stmt, err = s.db.Prepare("CREATE TABLE IF NOT EXISTS cacheUrls (id INTEGER not null constraint cacheUrls_pk primary key autoincrement, oid VARCHAR(20) not null)")
+	return s.migrateCacheUrls()
+}
+
+// addColumn adds a column to table unless it is there already.
+func (s *SqlDb) addColumn(table, column, definition string) error {
+	rows, err := s.db.Query("SELECT name FROM pragma_table_info(?);", table)
 	if err != nil {
-		return fmt.Errorf("cant prepare a query: %v", err)
+		return fmt.Errorf("cant read columns of %v: %v", table, err)
 	}
+	defer rows.Close()
 
-	_, err = stmt.Exec()
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return fmt.Errorf("cant read columns of %v: %v", table, err)
+		}
+		if name == column {
+			return nil
+		}
+	}
+	if err = rows.Err(); err != nil {
+		return fmt.Errorf("cant read columns of %v: %v", table, err)
+	}
+	rows.Close()
+
+	_, err = s.db.Exec("ALTER TABLE " + table + " ADD COLUMN " + column + " " + definition + ";")
 	if err != nil {
-		return fmt.Errorf("cant execute a prepare query: %v", err)
+		return fmt.Errorf("cant add column %v to %v: %v", column, table, err)
 	}
 
 	return nil
 }
 
-func (s *SqlDb) Insert(oid string, info *models.TableInfo) error {
-	s.mu.Lock()
-	defer s.mu.Unlock()
-	stmt, err := s.db.Prepare("INSERT INTO mib(oid, name, sub_ch, sub_total, descr, inf) values(?,?,?,?,?,?);")
+// widenMibText rebuilds mib tables created with VARCHAR(100) descr and inf
+// columns with TEXT ones. SQLite cannot change the type of a column, so the
+// table is copied over to a new one. The indexes are created again afterwards.
+func (s *SqlDb) widenMibText() error {
+	var definition string
+	err := s.db.QueryRow("SELECT sql FROM sqlite_master WHERE type = 'table' AND name = 'mib';").Scan(&definition)
 	if err != nil {
-		return fmt.Errorf("cant prepare a query: %v", err)
+		return fmt.Errorf("cant look up mib table: %v", err)
+	}
+	if !strings.Contains(definition, "VARCHAR(100)") {
+		return nil
+	}
+	columns := strings.Index(definition, "(")
+	if columns < 0 {
+		return fmt.Errorf("cant read mib table definition %q", definition)
 	}
 
-	if info.Name != "" {
-		_, err = stmt.Exec(oid, info.Name, info.SubCh, info.SubTotal, info.Desc, info.Inf)
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("cant begin a transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	widened := "CREATE TABLE mib_widened " + strings.ReplaceAll(definition[columns:], "VARCHAR(100)", "TEXT")
+	for _, query := range []string{
+		widened,
+		"INSERT INTO mib_widened SELECT * FROM mib;",
+		"DROP TABLE mib;",
+		"ALTER TABLE mib_widened RENAME TO mib;",
+	} {
+		_, err = tx.Exec(query)
 		if err != nil {
-			return fmt.Errorf("cant execute an insert query: %v", err)
+			return fmt.Errorf("cant widen mib table: %v", err)
 		}
 	}
 
+	err = tx.Commit()
+	if err != nil {
+		return fmt.Errorf("cant commit mib table widening: %v", err)
+	}
+
+	log.Printf("Widened descr and inf columns of mib")
+	return nil
+}
+
+// migrateCacheUrls moves databases written before the frontier existed over
+// to it. The old cacheUrls table could not tell fetched urls from pending
+// ones, so every oid it or the mib table knows about is queued again.
+func (s *SqlDb) migrateCacheUrls() error {
+	var name string
+	err := s.db.QueryRow("SELECT name FROM sqlite_master WHERE type = 'table' AND name = 'cacheUrls';").Scan(&name)
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("cant look up cacheUrls table: %v", err)
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("cant begin a transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	now := time.Now().Unix()
+	_, err = tx.Exec("INSERT OR IGNORE INTO frontier(oid, state, updated_at) "+
+		"SELECT oid, ?, ? FROM (SELECT oid FROM cacheUrls UNION SELECT oid FROM mib);", models.StatePending, now)
+	if err != nil {
+		return fmt.Errorf("cant copy cacheUrls to frontier: %v", err)
+	}
+
+	_, err = tx.Exec("DROP TABLE cacheUrls;")
+	if err != nil {
+		return fmt.Errorf("cant drop cacheUrls: %v", err)
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return fmt.Errorf("cant commit cacheUrls migration: %v", err)
+	}
+
+	log.Printf("Migrated cacheUrls to frontier")
 	return nil
 }
 
-func (s *SqlDb) GetLastOidCache() (string, error) {
-	var oid string
+// Enqueue adds oid to the frontier as pending unless it is already there.
+func (s *SqlDb) Enqueue(oid string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, err := s.db.Exec("INSERT OR IGNORE INTO frontier(oid, state, updated_at) values(?,?,?);",
+		oid, models.StatePending, time.Now().Unix())
+	if err != nil {
+		return fmt.Errorf("cant execute an enqueue query: %v", err)
+	}
+
+	return nil
+}
 
+// Lease hands out the pending url scope wants fetched that is most overdue,
+// or the oldest one among those never fetched, and marks it in flight until
+// the lease runs out. In-flight urls whose lease has expired are
+// put back to pending first. It returns nil when there is nothing pending.
+func (s *SqlDb) Lease(lease time.Duration, scope *models.Scope) (*models.FrontierItem, error) {
 	s.mu.Lock()
-	row := s.db.QueryRow("select oid from cacheUrls ORDER BY id DESC LIMIT 1;")
-	err := row.Scan(&oid)
+	defer s.mu.Unlock()
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("cant begin a transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
+	_, err = tx.Exec("UPDATE frontier SET state = ?, leased_until = NULL, updated_at = ? WHERE state = ? AND leased_until < ?;",
+		models.StatePending, now.Unix(), models.StateInFlight, now.Unix())
+	if err != nil {
+		return nil, fmt.Errorf("cant expire frontier leases: %v", err)
+	}
+
+	clause, args := scopeClause(scope)
+	item := &models.FrontierItem{}
+	err = tx.QueryRow("SELECT oid, attempts, COALESCE(etag, ''), COALESCE(last_modified, '') FROM frontier "+
+		"WHERE state = ? AND "+clause+" ORDER BY due_at, rowid LIMIT 1;", append([]interface{}{models.StatePending}, args...)...).
+		Scan(&item.Oid, &item.Attempts, &item.ETag, &item.LastModified)
+	if err == sql.ErrNoRows {
+		return nil, tx.Commit()
+	}
 	if err != nil {
-		s.mu.Unlock()
-		return "/", fmt.Errorf("cant find last added oid: %v", err)
+		return nil, fmt.Errorf("cant find pending oid: %v", err)
 	}
-	s.mu.Unlock()
 
-	err = s.DeleteCache(oid)
+	item.Attempts++
+	_, err = tx.Exec("UPDATE frontier SET state = ?, attempts = ?, leased_until = ?, updated_at = ? WHERE oid = ?;",
+		models.StateInFlight, item.Attempts, now.Add(lease).Unix(), now.Unix(), item.Oid)
 	if err != nil {
-		return "/", fmt.Errorf("cant delete last added oid: %v", err)
+		return nil, fmt.Errorf("cant lease oid: %v", err)
 	}
 
-	return oid, nil
+	err = tx.Commit()
+	if err != nil {
+		return nil, fmt.Errorf("cant commit a lease: %v", err)
+	}
+
+	return item, nil
 }
 
-func (s *SqlDb) InsertToCache(oid string) error {
+// Release puts a leased url back to pending without counting the attempt.
+func (s *SqlDb) Release(oid string) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
-	stmt, err := s.db.Prepare("INSERT INTO cacheUrls(oid) values(?);")
+
+	_, err := s.db.Exec("UPDATE frontier SET state = ?, attempts = max(attempts - 1, 0), leased_until = NULL, updated_at = ? "+
+		"WHERE oid = ? AND state = ?;", models.StatePending, time.Now().Unix(), oid, models.StateInFlight)
 	if err != nil {
-		return fmt.Errorf("cant prepare a query: %v", err)
+		return fmt.Errorf("cant execute a release query: %v", err)
 	}
 
-	_, err = stmt.Exec(oid)
+	return nil
+}
+
+// RecoverInFlight puts every in-flight url back to pending. It is meant for
+// start-up, when whoever leased them is gone.
+func (s *SqlDb) RecoverInFlight() (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	res, err := s.db.Exec("UPDATE frontier SET state = ?, leased_until = NULL, updated_at = ? WHERE state = ?;",
+		models.StatePending, time.Now().Unix(), models.StateInFlight)
+	if err != nil {
+		return 0, fmt.Errorf("cant execute a recover query: %v", err)
+	}
+
+	return res.RowsAffected()
+}
+
+// Fail records why a leased url could not be crawled after retries more
+// fetches than its lease counted. The url goes back to pending while it has
+// attempts left and is marked failed otherwise.
+func (s *SqlDb) Fail(oid string, reason string, retries int, maxAttempts int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, err := s.db.Exec("UPDATE frontier SET state = CASE WHEN attempts + ? < ? THEN ? ELSE ? END, attempts = attempts + ?, "+
+		"leased_until = NULL, last_error = ?, updated_at = ? WHERE oid = ?;",
+		retries, maxAttempts, models.StatePending, models.StateFailed, retries, reason, time.Now().Unix(), oid)
 	if err != nil {
-		return fmt.Errorf("cant execute an insert to cache query: %v", err)
+		return fmt.Errorf("cant execute a fail query: %v", err)
 	}
 
 	return nil
 }
 
-func (s *SqlDb) FillCache() (*sync.Map, error) {
-	urlCache := &sync.Map{}
-	rows, err := s.db.Query("select oid from mib;")
+// Refresh puts the done urls scope wants fetched whose TTL ran out back to
+// pending, so they are fetched again, most overdue first and conditionally on
+// the validators of their last fetch. A nil ttl picks every done url.
+func (s *SqlDb) Refresh(scope *models.Scope, ttl *models.TTL) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	overdue, err := s.overdue(scope, ttl, now)
 	if err != nil {
-		return nil, err
+		return 0, err
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("cant begin a transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	for _, o := range overdue {
+		_, err = tx.Exec("UPDATE frontier SET state = ?, attempts = 0, due_at = ?, updated_at = ? WHERE oid = ?;",
+			models.StatePending, o.DueAt.Unix(), now.Unix(), o.Oid)
+		if err != nil {
+			return 0, fmt.Errorf("cant execute a refresh query: %v", err)
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return 0, fmt.Errorf("cant commit a refresh: %v", err)
+	}
+
+	return int64(len(overdue)), nil
+}
+
+// Overdue lists the done urls scope wants fetched whose TTL ran out, most
+// overdue first.
+func (s *SqlDb) Overdue(scope *models.Scope, ttl *models.TTL) ([]*models.OverdueOid, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.overdue(scope, ttl, time.Now())
+}
+
+func (s *SqlDb) overdue(scope *models.Scope, ttl *models.TTL, now time.Time) ([]*models.OverdueOid, error) {
+	clause, args := scopeClause(scope)
+	rows, err := s.db.Query("SELECT oid, COALESCE(last_fetched, 0), "+
+		"COALESCE((SELECT sub_total FROM mib WHERE mib.oid = frontier.oid ORDER BY uid LIMIT 1), 0) "+
+		"FROM frontier WHERE state = ? AND "+clause+";", append([]interface{}{models.StateDone}, args...)...)
+	if err != nil {
+		return nil, fmt.Errorf("cant execute an overdue query: %v", err)
 	}
 	defer rows.Close()
 
+	var overdue []*models.OverdueOid
 	for rows.Next() {
 		var oid string
-		if err := rows.Scan(&oid); err != nil {
-			log.Printf("Cache filled partly")
-			return urlCache, err
+		var fetched int64
+		var subTotal int
+		err = rows.Scan(&oid, &fetched, &subTotal)
+		if err != nil {
+			return nil, fmt.Errorf("cant scan a frontier row: %v", err)
+		}
+
+		o := &models.OverdueOid{Oid: oid, TTL: ttl.For(oid, subTotal)}
+		if fetched > 0 {
+			o.LastFetched = time.Unix(fetched, 0)
+		}
+		o.DueAt = o.LastFetched.Add(o.TTL)
+		if !o.DueAt.After(now) {
+			overdue = append(overdue, o)
 		}
-		urlCache.Store(oid, nil)
 	}
 	if err = rows.Err(); err != nil {
-		return urlCache, err
+		return nil, fmt.Errorf("cant read frontier rows: %v", err)
 	}
 
-	log.Printf("Cache filled completely")
-	return urlCache, nil
+	sort.Slice(overdue, func(i, j int) bool {
+		return overdue[i].DueAt.Before(overdue[j].DueAt)
+	})
+	return overdue, nil
 }
 
-func (s *SqlDb) testConnection() error {
-	if err := s.db.Ping(); err != nil {
-		log.Fatalf("unable to reach database: %v", err)
-		return err
+// SavePage stores the records found on a page on behalf of crawl run runID,
+// archives its body, queues its links and siblings and marks the page done in
+// one transaction, so a crash never leaves a page done without its children or
+// the other way round. Records already known are only written when they
+// changed.
+func (s *SqlDb) SavePage(runID int64, page *models.Page) (*models.SaveResult, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("cant begin a transaction: %v", err)
 	}
+	defer tx.Rollback()
 
-	return nil
+	now := time.Now().Unix()
+	result, err := saveRecords(tx, runID, page, now)
+	if err != nil {
+		return nil, err
+	}
+
+	if page.Body != nil {
+		err = archivePage(tx, runID, page, now)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// siblings fill the gaps a parent page that failed or came back cut short
+	// left in the frontier
+	for _, oids := range [][]string{page.Links, page.Siblings} {
+		for _, oid := range oids {
+			_, err = tx.Exec("INSERT OR IGNORE INTO frontier(oid, state, updated_at) values(?,?,?);",
+				oid, models.StatePending, now)
+			if err != nil {
+				return nil, fmt.Errorf("cant execute an enqueue query: %v", err)
+			}
+		}
+	}
+
+	_, err = tx.Exec("UPDATE frontier SET state = ?, leased_until = NULL, last_error = NULL, etag = ?, last_modified = ?, "+
+		"last_fetched = ?, updated_at = ? WHERE oid = ?;",
+		models.StateDone, page.ETag, page.LastModified, now, now, page.Oid)
+	if err != nil {
+		return nil, fmt.Errorf("cant mark oid done: %v", err)
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, fmt.Errorf("cant commit a page: %v", err)
+	}
+
+	return result, nil
 }
 
-func (s *SqlDb) DeleteCache(oid string) error {
+// SaveRecords stores the records of page and tombstones the children it no
+// longer shows, like SavePage does, but leaves the frontier and the archive
+// alone. It is how pages parsed again from the archive are saved.
+func (s *SqlDb) SaveRecords(runID int64, page *models.Page) (*models.SaveResult, error) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	stmt, err := s.db.Prepare("DELETE FROM cacheUrls WHERE oid = (?);")
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("cant begin a transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	result, err := saveRecords(tx, runID, page, time.Now().Unix())
+	if err != nil {
+		return nil, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, fmt.Errorf("cant commit records: %v", err)
+	}
+
+	return result, nil
+}
+
+func saveRecords(tx *sql.Tx, runID int64, page *models.Page, now int64) (*models.SaveResult, error) {
+	result := &models.SaveResult{}
+	for oid, info := range page.Records {
+		if info.Name == "" {
+			continue
+		}
+		inserted, updated, err := upsertRecord(tx, runID, oid, info)
+		if err != nil {
+			return nil, err
+		}
+		if inserted {
+			result.Inserted = append(result.Inserted, oid)
+		}
+		if updated {
+			result.Updated = append(result.Updated, oid)
+		}
+	}
+
+	if !page.Unchanged && len(page.Children) > 0 {
+		var err error
+		result.Tombstoned, err = tombstone(tx, page.Oid, page.Children, now)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if page.Details != nil {
+		inserted, err := saveDetails(tx, runID, page)
+		if err != nil {
+			return nil, err
+		}
+		if inserted {
+			result.Inserted = append(result.Inserted, page.Oid)
+		}
+	}
+
+	var err error
+	result.Unlisted, err = unlisted(tx, page.Oid, page.Siblings)
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// saveDetails stores what the page of oid says about oid itself on its
+// record. Oids without a record, like the roots of a scoped crawl whose
+// parent page is never fetched, get one named after their details; the
+// parent page fills in the rest once it is saved. It reports whether it
+// inserted a record.
+func saveDetails(tx *sql.Tx, runID int64, page *models.Page) (bool, error) {
+	var known int
+	err := tx.QueryRow("SELECT count(*) FROM mib WHERE oid = ?;", page.Oid).Scan(&known)
+	if err != nil {
+		return false, fmt.Errorf("cant look up oid %v: %v", page.Oid, err)
+	}
+	details := page.Details
+	insert := known == 0 && page.Oid != "/"
+	if insert {
+		_, _, err = upsertRecord(tx, runID, page.Oid, &models.TableInfo{
+			Name:  detailsName(page.Oid, details),
+			SubCh: len(page.Children),
+		})
+		if err != nil {
+			return false, err
+		}
+	}
+
+	_, err = tx.Exec("UPDATE mib SET asn1_notation = ?, oid_iri = ?, dot_notation = ?, registration_authority = ?, "+
+		"registered_at = ?, registration_modified_at = ? WHERE oid = ?;", details.ASN1, details.IRI, details.Dot,
+		details.Authority, unixColumn(details.Created), unixColumn(details.Modified), page.Oid)
+	if err != nil {
+		return false, fmt.Errorf("cant save details of %v: %v", page.Oid, err)
+	}
+
+	return insert, nil
+}
+
+// detailsName picks the name of oid out of its ASN.1 notation, like "dod"
+// out of "{iso(1) identified-organization(3) dod(6)}", or falls back to its
+// number.
+func detailsName(oid string, details *models.OidDetails) string {
+	arcs := strings.Fields(strings.Trim(details.ASN1, "{} "))
+	if len(arcs) > 0 {
+		last := arcs[len(arcs)-1]
+		if i := strings.Index(last, "("); i > 0 {
+			return last[:i]
+		}
+	}
+	return arcName(oid, "")
+}
+
+// unlisted cross-checks the siblings a page shows against its parent page.
+// It returns the siblings without a live record although the parent page
+// was fetched, so it should have listed them.
+func unlisted(tx *sql.Tx, oid string, siblings []string) ([]string, error) {
+	if len(siblings) == 0 {
+		return nil, nil
+	}
+	var fetched int
+	err := tx.QueryRow("SELECT count(*) FROM frontier WHERE oid = ? AND last_fetched IS NOT NULL;",
+		models.Parent(oid)).Scan(&fetched)
+	if err != nil {
+		return nil, fmt.Errorf("cant look up parent of %v: %v", oid, err)
+	}
+	if fetched == 0 {
+		return nil, nil
+	}
+
+	var missing []string
+	for _, sibling := range siblings {
+		var listed int
+		err = tx.QueryRow("SELECT count(*) FROM mib WHERE oid = ? AND tombstoned_at IS NULL;", sibling).Scan(&listed)
+		if err != nil {
+			return nil, fmt.Errorf("cant look up sibling %v: %v", sibling, err)
+		}
+		if listed == 0 {
+			missing = append(missing, sibling)
+		}
+	}
+
+	return missing, nil
+}
+
+// upsertRecord inserts the record of oid, or updates it when it differs from
+// what is stored. The values an update replaces are kept in mib_history.
+func upsertRecord(tx *sql.Tx, runID int64, oid string, info *models.TableInfo) (bool, bool, error) {
+	var uid int64
+	var oldRun sql.NullInt64
+	old := &models.TableInfo{}
+	err := tx.QueryRow("SELECT uid, name, sub_ch, COALESCE(sub_total, 0), COALESCE(descr, ''), COALESCE(inf, ''), run_id "+
+		"FROM mib WHERE oid = ? ORDER BY uid LIMIT 1;", oid).
+		Scan(&uid, &old.Name, &old.SubCh, &old.SubTotal, &old.Desc, &old.Inf, &oldRun)
+	if err == sql.ErrNoRows {
+		// the records below went by the number of oid so far
+		oldPath, err := pathOf(tx, oid)
+		if err != nil {
+			return false, false, err
+		}
+		path, err := namePath(tx, oid, info.Name)
+		if err != nil {
+			return false, false, err
+		}
+		_, err = tx.Exec("INSERT INTO mib(oid, name, sub_ch, sub_total, descr, inf, run_id, parent, depth, name_path) "+
+			"values(?,?,?,?,?,?,?,?,?,?);", oid, info.Name, info.SubCh, info.SubTotal, info.Desc, info.Inf, runID,
+			parentColumn(oid), models.Depth(oid), path)
+		if err != nil {
+			return false, false, fmt.Errorf("cant execute an insert query: %v", err)
+		}
+		return true, false, renamePath(tx, oid, oldPath, path)
+	}
+	if err != nil {
+		return false, false, fmt.Errorf("cant look up oid %v: %v", oid, err)
+	}
+	if *old == *info {
+		return false, false, nil
+	}
+
+	_, err = tx.Exec("INSERT INTO mib_history(oid, name, sub_ch, sub_total, descr, inf, run_id, replaced_at, replaced_by) "+
+		"values(?,?,?,?,?,?,?,?,?);", oid, old.Name, old.SubCh, old.SubTotal, old.Desc, old.Inf, oldRun,
+		time.Now().Unix(), runID)
 	if err != nil {
-		return fmt.Errorf("cant prepare a query: %v", err)
+		return false, false, fmt.Errorf("cant execute a history query: %v", err)
 	}
 
-	_, err = stmt.Exec(oid)
+	_, err = tx.Exec("UPDATE mib SET name = ?, sub_ch = ?, sub_total = ?, descr = ?, inf = ?, run_id = ? WHERE uid = ?;",
+		info.Name, info.SubCh, info.SubTotal, info.Desc, info.Inf, runID, uid)
 	if err != nil {
-		return fmt.Errorf("cant execute a delete cache query: %v", err)
+		return false, false, fmt.Errorf("cant execute an update query: %v", err)
+	}
+	if arcName(oid, old.Name) == arcName(oid, info.Name) {
+		return false, true, nil
+	}
+
+	oldPath, err := pathOf(tx, oid)
+	if err != nil {
+		return false, false, err
+	}
+	path, err := namePath(tx, oid, info.Name)
+	if err != nil {
+		return false, false, err
+	}
+	_, err = tx.Exec("UPDATE mib SET name_path = ? WHERE oid = ?;", path, oid)
+	if err != nil {
+		return false, false, fmt.Errorf("cant execute an update query: %v", err)
+	}
+
+	return false, true, renamePath(tx, oid, oldPath, path)
+}
+
+// tombstone marks the stored direct children of parent that are not among
+// children as gone since now, and revives the tombstoned ones that are back.
+// It returns the oids it tombstoned. A page that shows no children at all is
+// more likely broken than emptied, so callers skip it.
+func tombstone(tx *sql.Tx, parent string, children []string, now int64) ([]string, error) {
+	listed := make(map[string]bool, len(children))
+	for _, child := range children {
+		listed[child] = true
+	}
+
+	cond, args := underClause(parent)
+	rows, err := tx.Query("SELECT DISTINCT oid, tombstoned_at IS NOT NULL FROM mib WHERE "+cond+
+		" AND oid != ? AND instr(substr(oid, ?), '.') = 0;", append(args, parent, len(childPrefix(parent))+1)...)
+	if err != nil {
+		return nil, fmt.Errorf("cant look up children of %v: %v", parent, err)
+	}
+	var gone, back []string
+	for rows.Next() {
+		var oid string
+		var tombstoned bool
+		err = rows.Scan(&oid, &tombstoned)
+		if err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("cant scan a child row: %v", err)
+		}
+		if !listed[oid] && !tombstoned {
+			gone = append(gone, oid)
+		}
+		if listed[oid] && tombstoned {
+			back = append(back, oid)
+		}
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("cant read child rows: %v", err)
+	}
+
+	for _, oid := range gone {
+		_, err = tx.Exec("UPDATE mib SET tombstoned_at = ? WHERE oid = ?;", now, oid)
+		if err != nil {
+			return nil, fmt.Errorf("cant tombstone oid %v: %v", oid, err)
+		}
+	}
+	for _, oid := range back {
+		_, err = tx.Exec("UPDATE mib SET tombstoned_at = NULL WHERE oid = ?;", oid)
+		if err != nil {
+			return nil, fmt.Errorf("cant revive oid %v: %v", oid, err)
+		}
+	}
+
+	return gone, nil
+}
+
+// childPrefix is what the oids of the children of parent start with.
+func childPrefix(parent string) string {
+	if parent == "/" {
+		return "/"
+	}
+	return parent + "."
+}
+
+// scopeClause builds the condition matching the oids scope.Follow accepts.
+func scopeClause(scope *models.Scope) (string, []interface{}) {
+	if scope == nil {
+		return "1", nil
+	}
+
+	var args []interface{}
+	var roots []string
+	for _, root := range scope.Roots {
+		cond, rootArgs := underClause(root)
+		args = append(args, rootArgs...)
+		if scope.MaxDepth > 0 {
+			cond += " AND (CASE WHEN oid = '/' THEN 0 ELSE length(oid) - length(replace(oid, '.', '')) + 1 END) < ?"
+			args = append(args, models.Depth(root)+scope.MaxDepth)
+		}
+		roots = append(roots, "("+cond+")")
+	}
+
+	clause := "(" + strings.Join(roots, " OR ") + ")"
+	for _, ex := range scope.Exclude {
+		cond, exArgs := underClause(ex)
+		clause += " AND NOT (" + cond + ")"
+		args = append(args, exArgs...)
+	}
+
+	return clause, args
+}
+
+func underClause(root string) (string, []interface{}) {
+	if root == "/" {
+		return "oid LIKE '/%'", nil
+	}
+	return "(oid = ? OR oid LIKE ?)", []interface{}{root, root + ".%"}
+}
+
+func (s *SqlDb) testConnection() error {
+	if err := s.db.Ping(); err != nil {
+		log.Fatalf("unable to reach database: %v", err)
+		return err
 	}
 
 	return nil
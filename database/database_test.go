@@ -0,0 +1,642 @@
+package database
+
+import (
+	"database/sql"
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"hello/scraper/models"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestDb(t *testing.T) *SqlDb {
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "test.sqlite"))
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+
+	sqlDb := NewSqlDb(db)
+	require.NoError(t, sqlDb.Prepare())
+	return sqlDb
+}
+
+func frontierState(t *testing.T, s *SqlDb, oid string) (string, int) {
+	var state string
+	var attempts int
+	err := s.db.QueryRow("SELECT state, attempts FROM frontier WHERE oid = ?;", oid).Scan(&state, &attempts)
+	require.NoError(t, err)
+	return state, attempts
+}
+
+func TestSqlDb_Lease(t *testing.T) {
+	s := newTestDb(t)
+	require.NoError(t, s.Enqueue("/1"))
+	require.NoError(t, s.Enqueue("/2"))
+	require.NoError(t, s.Enqueue("/1"))
+
+	item, err := s.Lease(time.Minute, nil)
+	require.NoError(t, err)
+	assert.Equal(t, &models.FrontierItem{Oid: "/1", Attempts: 1}, item)
+
+	item, err = s.Lease(time.Minute, nil)
+	require.NoError(t, err)
+	assert.Equal(t, &models.FrontierItem{Oid: "/2", Attempts: 1}, item)
+
+	item, err = s.Lease(time.Minute, nil)
+	require.NoError(t, err)
+	assert.Nil(t, item)
+
+	state, _ := frontierState(t, s, "/1")
+	assert.Equal(t, models.StateInFlight, state)
+}
+
+func TestSqlDb_LeaseScope(t *testing.T) {
+	s := newTestDb(t)
+	for _, oid := range []string{"/1.3.6.1.4", "/1.3.6.1.2.1.1", "/1.3.6.1.2.1.1.1", "/1.3.6.1.2.1.2.2", "/1.3.6.1.2.1"} {
+		require.NoError(t, s.Enqueue(oid))
+	}
+	scope := models.NewScope([]string{"1.3.6.1.2.1"}, 2, []string{"1.3.6.1.2.1.2"})
+
+	var leased []string
+	for {
+		item, err := s.Lease(time.Minute, scope)
+		require.NoError(t, err)
+		if item == nil {
+			break
+		}
+		leased = append(leased, item.Oid)
+	}
+
+	assert.Equal(t, []string{"/1.3.6.1.2.1.1", "/1.3.6.1.2.1"}, leased)
+}
+
+func TestSqlDb_LeaseExpired(t *testing.T) {
+	s := newTestDb(t)
+	require.NoError(t, s.Enqueue("/1"))
+
+	_, err := s.Lease(-time.Minute, nil)
+	require.NoError(t, err)
+
+	item, err := s.Lease(time.Minute, nil)
+	require.NoError(t, err)
+	assert.Equal(t, &models.FrontierItem{Oid: "/1", Attempts: 2}, item)
+}
+
+func TestSqlDb_ReleaseAndRecover(t *testing.T) {
+	s := newTestDb(t)
+	require.NoError(t, s.Enqueue("/1"))
+	require.NoError(t, s.Enqueue("/2"))
+	_, err := s.Lease(time.Minute, nil)
+	require.NoError(t, err)
+	_, err = s.Lease(time.Minute, nil)
+	require.NoError(t, err)
+
+	require.NoError(t, s.Release("/1"))
+	state, attempts := frontierState(t, s, "/1")
+	assert.Equal(t, models.StatePending, state)
+	assert.Equal(t, 0, attempts)
+
+	recovered, err := s.RecoverInFlight()
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), recovered)
+	state, attempts = frontierState(t, s, "/2")
+	assert.Equal(t, models.StatePending, state)
+	assert.Equal(t, 1, attempts)
+}
+
+func TestSqlDb_Fail(t *testing.T) {
+	s := newTestDb(t)
+	require.NoError(t, s.Enqueue("/1"))
+
+	_, err := s.Lease(time.Minute, nil)
+	require.NoError(t, err)
+	require.NoError(t, s.Fail("/1", "timeout", 0, 2))
+	state, _ := frontierState(t, s, "/1")
+	assert.Equal(t, models.StatePending, state)
+
+	_, err = s.Lease(time.Minute, nil)
+	require.NoError(t, err)
+	require.NoError(t, s.Fail("/1", "timeout", 0, 2))
+	state, attempts := frontierState(t, s, "/1")
+	assert.Equal(t, models.StateFailed, state)
+	assert.Equal(t, 2, attempts)
+}
+
+func TestSqlDb_FailRetries(t *testing.T) {
+	s := newTestDb(t)
+	require.NoError(t, s.Enqueue("/1"))
+
+	_, err := s.Lease(time.Minute, nil)
+	require.NoError(t, err)
+	require.NoError(t, s.Fail("/1", "timeout", 1, 3))
+	state, attempts := frontierState(t, s, "/1")
+	assert.Equal(t, models.StatePending, state)
+	assert.Equal(t, 2, attempts)
+
+	item, err := s.Lease(time.Minute, nil)
+	require.NoError(t, err)
+	assert.Equal(t, 3, item.Attempts)
+	require.NoError(t, s.Fail("/1", "timeout", 0, 3))
+	state, _ = frontierState(t, s, "/1")
+	assert.Equal(t, models.StateFailed, state)
+}
+
+func TestSqlDb_SavePage(t *testing.T) {
+	s := newTestDb(t)
+	require.NoError(t, s.Enqueue("/"))
+	_, err := s.Lease(time.Minute, nil)
+	require.NoError(t, err)
+
+	saved, err := s.SavePage(1, &models.Page{
+		Oid:   "/",
+		Links: []string{"/0", "/1"},
+		Records: map[string]*models.TableInfo{
+			"/0": {Name: "itu-t", SubCh: 7},
+			"/1": {Name: "iso", SubCh: 4},
+		},
+	})
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{"/0", "/1"}, saved.Inserted)
+
+	state, _ := frontierState(t, s, "/")
+	assert.Equal(t, models.StateDone, state)
+	state, _ = frontierState(t, s, "/1")
+	assert.Equal(t, models.StatePending, state)
+
+	var count int
+	require.NoError(t, s.db.QueryRow("SELECT count(*) FROM mib WHERE run_id = 1;").Scan(&count))
+	assert.Equal(t, 2, count)
+}
+
+func TestSqlDb_SavePageSiblings(t *testing.T) {
+	s := newTestDb(t)
+	require.NoError(t, s.Enqueue("/1.3"))
+	_, err := s.Lease(time.Minute, nil)
+	require.NoError(t, err)
+
+	// the parent page was never fetched, so there is nothing to cross-check
+	saved, err := s.SavePage(1, &models.Page{Oid: "/1.3", Siblings: []string{"/1.0", "/1.2"}})
+	require.NoError(t, err)
+	assert.Empty(t, saved.Unlisted)
+	state, _ := frontierState(t, s, "/1.2")
+	assert.Equal(t, models.StatePending, state)
+
+	require.NoError(t, s.Enqueue("/1"))
+	_, err = s.Lease(time.Minute, models.NewScope(nil, 0, []string{"/1.0", "/1.2"}))
+	require.NoError(t, err)
+	_, err = s.SavePage(1, &models.Page{
+		Oid:      "/1",
+		Links:    []string{"/1.0", "/1.3"},
+		Records:  map[string]*models.TableInfo{"/1.0": {Name: "standard"}, "/1.3": {Name: "org"}},
+		Children: []string{"/1.0", "/1.3"},
+	})
+	require.NoError(t, err)
+
+	saved, err = s.SavePage(1, &models.Page{Oid: "/1.3", Siblings: []string{"/1.0", "/1.2", "/1.5"}})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"/1.2", "/1.5"}, saved.Unlisted)
+	state, _ = frontierState(t, s, "/1.5")
+	assert.Equal(t, models.StatePending, state)
+}
+
+func TestSqlDb_SavePageTombstones(t *testing.T) {
+	s := newTestDb(t)
+	save := func(page *models.Page) *models.SaveResult {
+		require.NoError(t, s.Enqueue(page.Oid))
+		_, err := s.db.Exec("UPDATE frontier SET state = ? WHERE oid = ?;", models.StateInFlight, page.Oid)
+		require.NoError(t, err)
+		saved, err := s.SavePage(1, page)
+		require.NoError(t, err)
+		return saved
+	}
+	records := func(oids ...string) map[string]*models.TableInfo {
+		records := make(map[string]*models.TableInfo)
+		for _, oid := range oids {
+			records[oid] = &models.TableInfo{Name: oid}
+		}
+		return records
+	}
+
+	save(&models.Page{Oid: "/1", Records: records("/1.2", "/1.3", "/1.3.6"), Children: []string{"/1.2", "/1.3"}})
+	save(&models.Page{Oid: "/1.3", Records: records("/1.3.6"), Children: []string{"/1.3.6"}})
+
+	saved := save(&models.Page{Oid: "/1", Records: records("/1.3"), Children: []string{"/1.3"}})
+	assert.Equal(t, []string{"/1.2"}, saved.Tombstoned)
+	versions, err := s.History("/1.2")
+	require.NoError(t, err)
+	assert.False(t, versions[0].TombstonedAt.IsZero())
+	versions, err = s.History("/1.3.6")
+	require.NoError(t, err)
+	assert.True(t, versions[0].TombstonedAt.IsZero())
+
+	saved = save(&models.Page{Oid: "/1", Unchanged: true})
+	assert.Empty(t, saved.Tombstoned)
+	saved = save(&models.Page{Oid: "/1", Records: records("/1.2", "/1.3"), Children: []string{"/1.2", "/1.3"}})
+	assert.Empty(t, saved.Tombstoned)
+	versions, err = s.History("/1.2")
+	require.NoError(t, err)
+	assert.True(t, versions[0].TombstonedAt.IsZero())
+
+	// a page with a malformed /1.2 row comes without children
+	saved = save(&models.Page{Oid: "/1", Records: records("/1.3")})
+	assert.Empty(t, saved.Tombstoned)
+	versions, err = s.History("/1.2")
+	require.NoError(t, err)
+	assert.True(t, versions[0].TombstonedAt.IsZero())
+}
+
+func TestSqlDb_Archive(t *testing.T) {
+	s := newTestDb(t)
+	for i, body := range []string{"<html>a</html>", "<html>a</html>", "<html>b</html>"} {
+		require.NoError(t, s.Enqueue("/1"))
+		_, err := s.Lease(time.Minute, nil)
+		require.NoError(t, err)
+		_, err = s.SavePage(int64(i+1), &models.Page{Oid: "/1", URL: "https://oidref.com/1", Body: []byte(body)})
+		require.NoError(t, err)
+		_, err = s.Refresh(nil, nil)
+		require.NoError(t, err)
+	}
+
+	pages, err := s.Archive("/1")
+	require.NoError(t, err)
+	require.Len(t, pages, 3)
+	assert.Equal(t, int64(3), pages[0].RunID)
+	assert.Equal(t, "https://oidref.com/1", pages[0].URL)
+	assert.Equal(t, pages[1].Hash, pages[2].Hash)
+	assert.NotEqual(t, pages[0].Hash, pages[1].Hash)
+
+	var blobs int
+	require.NoError(t, s.db.QueryRow("SELECT count(*) FROM page_blobs;").Scan(&blobs))
+	assert.Equal(t, 2, blobs)
+
+	body, err := s.ArchivedBody(pages[0].Hash)
+	require.NoError(t, err)
+	assert.Equal(t, "<html>b</html>", string(body))
+
+	latest, err := s.LatestArchived(models.NewScope([]string{"1"}, 0, nil))
+	require.NoError(t, err)
+	require.Len(t, latest, 1)
+	assert.Equal(t, pages[0].Hash, latest[0].Hash)
+	latest, err = s.LatestArchived(models.NewScope([]string{"2"}, 0, nil))
+	require.NoError(t, err)
+	assert.Empty(t, latest)
+
+	imported := &models.ArchivedPage{Oid: "/2", URL: "https://oidref.com/2", FetchedAt: time.Unix(1660996800, 0),
+		Body: []byte("<html>a</html>")}
+	added, err := s.ImportPage(imported)
+	require.NoError(t, err)
+	assert.True(t, added)
+	added, err = s.ImportPage(imported)
+	require.NoError(t, err)
+	assert.False(t, added)
+	pages, err = s.Archive("/2")
+	require.NoError(t, err)
+	assert.Len(t, pages, 1)
+	require.NoError(t, s.db.QueryRow("SELECT count(*) FROM page_blobs;").Scan(&blobs))
+	assert.Equal(t, 2, blobs)
+
+	fetch, err := s.LatestFetch("https://oidref.com/1")
+	require.NoError(t, err)
+	assert.Equal(t, "<html>b</html>", string(fetch.Body))
+	fetch, err = s.LatestFetch("https://oidref.com/3")
+	require.NoError(t, err)
+	assert.Nil(t, fetch)
+}
+
+func TestSqlDb_Refresh(t *testing.T) {
+	s := newTestDb(t)
+	require.NoError(t, s.Enqueue("/"))
+	_, err := s.Lease(time.Minute, nil)
+	require.NoError(t, err)
+	_, err = s.SavePage(1, &models.Page{
+		Oid:          "/",
+		Links:        []string{"/1"},
+		Records:      map[string]*models.TableInfo{"/1": {Name: "iso", SubCh: 4}},
+		ETag:         `"abc"`,
+		LastModified: "Sat, 20 Aug 2022 12:00:00 GMT",
+	})
+	require.NoError(t, err)
+
+	refreshed, err := s.Refresh(nil, models.NewTTL(time.Hour, nil))
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), refreshed)
+
+	refreshed, err = s.Refresh(models.NewScope(nil, 0, []string{"1"}), nil)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), refreshed)
+
+	item, err := s.Lease(time.Minute, models.NewScope(nil, 0, []string{"1"}))
+	require.NoError(t, err)
+	assert.Equal(t, &models.FrontierItem{Oid: "/", Attempts: 1, ETag: `"abc"`, LastModified: "Sat, 20 Aug 2022 12:00:00 GMT"}, item)
+
+	saved, err := s.SavePage(2, &models.Page{
+		Oid:     "/",
+		Links:   []string{"/1", "/2"},
+		Records: map[string]*models.TableInfo{"/1": {Name: "iso", SubCh: 5}, "/2": {Name: "joint-iso-itu-t"}},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"/2"}, saved.Inserted)
+	assert.Equal(t, []string{"/1"}, saved.Updated)
+
+	var subCh, runID int
+	require.NoError(t, s.db.QueryRow("SELECT sub_ch, run_id FROM mib WHERE oid = '/1';").Scan(&subCh, &runID))
+	assert.Equal(t, 5, subCh)
+	assert.Equal(t, 2, runID)
+}
+
+func TestSqlDb_Overdue(t *testing.T) {
+	s := newTestDb(t)
+	require.NoError(t, s.Enqueue("/"))
+	_, err := s.Lease(time.Minute, nil)
+	require.NoError(t, err)
+	_, err = s.SavePage(1, &models.Page{
+		Oid:   "/",
+		Links: []string{"/1", "/1.3.6.1.4.1.343.2.7"},
+		Records: map[string]*models.TableInfo{
+			"/1":                   {Name: "iso", SubTotal: 999999},
+			"/1.3.6.1.4.1.343.2.7": {Name: "leaf"},
+		},
+	})
+	require.NoError(t, err)
+	for _, oid := range []string{"/1", "/1.3.6.1.4.1.343.2.7"} {
+		_, err = s.Lease(time.Minute, nil)
+		require.NoError(t, err)
+		_, err = s.SavePage(1, &models.Page{Oid: oid})
+		require.NoError(t, err)
+	}
+	hoursAgo := func(oid string, hours int) {
+		_, err := s.db.Exec("UPDATE frontier SET last_fetched = ? WHERE oid = ?;",
+			time.Now().Add(-time.Duration(hours)*time.Hour).Unix(), oid)
+		require.NoError(t, err)
+	}
+	hoursAgo("/", 2)
+	hoursAgo("/1", 10)
+	hoursAgo("/1.3.6.1.4.1.343.2.7", 30)
+
+	ttl := models.NewTTL(10*time.Hour, map[string]time.Duration{"1.3.6.1.4.1": 2 * time.Hour})
+	assert.Equal(t, 10*time.Hour/4, ttl.For("/", 999999))
+	assert.Equal(t, 2*time.Hour*4, ttl.For("/1.3.6.1.4.1.343.2.7", 0))
+
+	overdue, err := s.Overdue(nil, ttl)
+	require.NoError(t, err)
+	var oids []string
+	for _, o := range overdue {
+		oids = append(oids, o.Oid)
+	}
+	assert.Equal(t, []string{"/1.3.6.1.4.1.343.2.7", "/1"}, oids)
+
+	refreshed, err := s.Refresh(models.NewScope([]string{"1"}, 0, nil), ttl)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), refreshed)
+	item, err := s.Lease(time.Minute, nil)
+	require.NoError(t, err)
+	assert.Equal(t, "/1.3.6.1.4.1.343.2.7", item.Oid)
+}
+
+func TestSqlDb_History(t *testing.T) {
+	s := newTestDb(t)
+	versions, err := s.History("/1")
+	require.NoError(t, err)
+	assert.Empty(t, versions)
+
+	for _, subCh := range []int{4, 4, 5, 6} {
+		runID, err := s.StartRun("")
+		require.NoError(t, err)
+		require.NoError(t, s.Enqueue("/"))
+		_, err = s.Lease(time.Minute, nil)
+		require.NoError(t, err)
+		_, err = s.SavePage(runID, &models.Page{
+			Oid:     "/",
+			Records: map[string]*models.TableInfo{"/1": {Name: "iso", SubCh: subCh}},
+		})
+		require.NoError(t, err)
+		_, err = s.Refresh(nil, nil)
+		require.NoError(t, err)
+	}
+
+	versions, err = s.History("/1")
+	require.NoError(t, err)
+	require.Len(t, versions, 3)
+	assert.Equal(t, models.TableInfo{Name: "iso", SubCh: 6}, versions[0].Info)
+	assert.Equal(t, int64(4), versions[0].RunID)
+	assert.True(t, versions[0].Until.IsZero())
+	assert.Equal(t, models.TableInfo{Name: "iso", SubCh: 5}, versions[1].Info)
+	assert.Equal(t, int64(3), versions[1].RunID)
+	assert.Equal(t, int64(4), versions[1].ReplacedBy)
+	assert.Equal(t, models.TableInfo{Name: "iso", SubCh: 4}, versions[2].Info)
+	assert.Equal(t, int64(1), versions[2].RunID)
+	assert.Equal(t, int64(3), versions[2].ReplacedBy)
+	assert.False(t, versions[2].Since.IsZero())
+	assert.Nil(t, versions[0].Details)
+}
+
+func TestSqlDb_SavePageDetails(t *testing.T) {
+	s := newTestDb(t)
+	_, err := s.SavePage(1, &models.Page{Oid: "/1", Records: map[string]*models.TableInfo{"/1.3": {Name: "org"}}})
+	require.NoError(t, err)
+
+	details := &models.OidDetails{
+		ASN1:      "{iso(1) identified-organization(3)}",
+		IRI:       "/ISO/Identified-Organization",
+		Dot:       "1.3",
+		Authority: "ISO",
+		Created:   time.Date(2016, 9, 5, 15, 4, 0, 0, time.UTC),
+	}
+	_, err = s.SavePage(1, &models.Page{Oid: "/1.3", Details: details})
+	require.NoError(t, err)
+
+	versions, err := s.History("/1.3")
+	require.NoError(t, err)
+	require.Len(t, versions, 1)
+	require.NotNil(t, versions[0].Details)
+	assert.Equal(t, details.ASN1, versions[0].Details.ASN1)
+	assert.Equal(t, details.IRI, versions[0].Details.IRI)
+	assert.Equal(t, details.Dot, versions[0].Details.Dot)
+	assert.Equal(t, details.Authority, versions[0].Details.Authority)
+	assert.True(t, details.Created.Equal(versions[0].Details.Created))
+	assert.True(t, versions[0].Details.Modified.IsZero())
+	// the record itself is the parent page's
+	assert.Equal(t, models.TableInfo{Name: "org"}, versions[0].Info)
+}
+
+func TestSqlDb_SavePageDetailsWithoutRecord(t *testing.T) {
+	s := newTestDb(t)
+	details := &models.OidDetails{ASN1: "{iso(1) identified-organization(3) dod(6)}", Dot: "1.3.6"}
+
+	// a scoped root is fetched without its parent page
+	result, err := s.SavePage(1, &models.Page{Oid: "/1.3.6", Details: details, Children: []string{"/1.3.6.1"}})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"/1.3.6"}, result.Inserted)
+
+	versions, err := s.History("/1.3.6")
+	require.NoError(t, err)
+	require.Len(t, versions, 1)
+	require.NotNil(t, versions[0].Details)
+	assert.Equal(t, details.ASN1, versions[0].Details.ASN1)
+	assert.Equal(t, details.Dot, versions[0].Details.Dot)
+	assert.Equal(t, models.TableInfo{Name: "dod", SubCh: 1}, versions[0].Info)
+
+	// the parent page later tells the record itself
+	_, err = s.SavePage(1, &models.Page{Oid: "/1.3", Records: map[string]*models.TableInfo{"/1.3.6": {Name: "dod", SubCh: 1}}})
+	require.NoError(t, err)
+	versions, err = s.History("/1.3.6")
+	require.NoError(t, err)
+	require.Len(t, versions, 1)
+	assert.Equal(t, details.ASN1, versions[0].Details.ASN1)
+}
+
+func TestSqlDb_Runs(t *testing.T) {
+	s := newTestDb(t)
+
+	first, err := s.StartRun(`{"roots":"/"}`)
+	require.NoError(t, err)
+	second, err := s.StartRun(`{"roots":"1.3.6.1"}`)
+	require.NoError(t, err)
+	require.NoError(t, s.FinishRun(second, &models.CrawlResult{PagesFetched: 3, RecordsInserted: 10, ExitReason: models.ExitCompleted}))
+
+	// another process may still be running the first run
+	var reason sql.NullString
+	require.NoError(t, s.db.QueryRow("SELECT exit_reason FROM crawl_runs WHERE id = ?;", first).Scan(&reason))
+	assert.False(t, reason.Valid)
+
+	aborted, err := s.AbortRuns()
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), aborted)
+	require.NoError(t, s.db.QueryRow("SELECT exit_reason FROM crawl_runs WHERE id = ?;", first).Scan(&reason))
+	assert.Equal(t, models.ExitAborted, reason.String)
+
+	var config string
+	var pages, records int64
+	err = s.db.QueryRow("SELECT config, exit_reason, pages_fetched, records_inserted FROM crawl_runs WHERE id = ? AND ended_at IS NOT NULL;",
+		second).Scan(&config, &reason, &pages, &records)
+	require.NoError(t, err)
+	assert.Equal(t, `{"roots":"1.3.6.1"}`, config)
+	assert.Equal(t, models.ExitCompleted, reason.String)
+	assert.Equal(t, int64(3), pages)
+	assert.Equal(t, int64(10), records)
+}
+
+func TestSqlDb_migrateCacheUrls(t *testing.T) {
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "old.sqlite"))
+	require.NoError(t, err)
+	defer db.Close()
+	_, err = db.Exec("CREATE TABLE cacheUrls (id INTEGER not null constraint cacheUrls_pk primary key autoincrement, oid VARCHAR(20) not null);" +
+		"INSERT INTO cacheUrls(oid) values('/1.2'),('/1.2'),('/1.0');")
+	require.NoError(t, err)
+
+	s := NewSqlDb(db)
+	require.NoError(t, s.Prepare())
+
+	var count int
+	require.NoError(t, db.QueryRow("SELECT count(*) FROM frontier WHERE state = ?;", models.StatePending).Scan(&count))
+	assert.Equal(t, 2, count)
+	err = db.QueryRow("SELECT name FROM sqlite_master WHERE name = 'cacheUrls';").Scan(new(string))
+	assert.Equal(t, sql.ErrNoRows, err)
+}
+
+func TestSqlDb_widenMibText(t *testing.T) {
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "old.sqlite"))
+	require.NoError(t, err)
+	defer db.Close()
+	_, err = db.Exec("CREATE TABLE mib (uid INTEGER not null constraint mib_pk primary key autoincrement," +
+		"oid VARCHAR(64) not null,name VARCHAR(64) not null,sub_ch INTEGER not null,sub_total INTEGER," +
+		"descr VARCHAR(100),inf VARCHAR(100) default '-');" +
+		"INSERT INTO mib(oid, name, sub_ch, sub_total, descr, inf) values('/1.3', 'org', 1, 5, 'short', 'info');")
+	require.NoError(t, err)
+
+	s := NewSqlDb(db)
+	require.NoError(t, s.Prepare())
+	// a second run finds the table widened already
+	require.NoError(t, s.Prepare())
+
+	var definition string
+	require.NoError(t, db.QueryRow("SELECT sql FROM sqlite_master WHERE name = 'mib';").Scan(&definition))
+	assert.NotContains(t, definition, "VARCHAR(100)")
+	assert.Contains(t, definition, "tombstoned_at")
+
+	history, err := s.History("/1.3")
+	require.NoError(t, err)
+	require.Len(t, history, 1)
+	assert.Equal(t, models.TableInfo{Name: "org", SubCh: 1, SubTotal: 5, Desc: "short", Inf: "info"}, history[0].Info)
+
+	long := strings.Repeat("description ", 50)
+	_, err = s.SavePage(1, &models.Page{Oid: "/1.3", Records: map[string]*models.TableInfo{
+		"/1.3.6": {Name: "dod", Desc: long},
+	}})
+	require.NoError(t, err)
+	require.NoError(t, db.QueryRow("SELECT descr FROM mib WHERE oid = '/1.3.6';").Scan(&definition))
+	assert.Equal(t, long, definition)
+
+	var index string
+	require.NoError(t, db.QueryRow("SELECT name FROM sqlite_master WHERE name = 'mib_oid_idx';").Scan(&index))
+}
+
+func treeColumns(t *testing.T, s *SqlDb, oid string) (string, int, string) {
+	var parent, path sql.NullString
+	var depth int
+	err := s.db.QueryRow("SELECT parent, depth, name_path FROM mib WHERE oid = ?;", oid).Scan(&parent, &depth, &path)
+	require.NoError(t, err)
+	return parent.String, depth, path.String
+}
+
+func TestSqlDb_SavePageTree(t *testing.T) {
+	s := newTestDb(t)
+	save := func(oid string, records map[string]*models.TableInfo) {
+		_, err := s.SavePage(1, &models.Page{Oid: oid, Records: records})
+		require.NoError(t, err)
+	}
+
+	save("/1.3", map[string]*models.TableInfo{"/1.3.6": {Name: "dod"}, "/1.3.6.1": {Name: "internet"}})
+	parent, depth, path := treeColumns(t, s, "/1.3.6.1")
+	assert.Equal(t, "/1.3.6", parent)
+	assert.Equal(t, 4, depth)
+	assert.Equal(t, "1.3.dod.internet", path)
+
+	save("/", map[string]*models.TableInfo{"/1": {Name: "iso"}})
+	parent, depth, path = treeColumns(t, s, "/1")
+	assert.Equal(t, "/", parent)
+	assert.Equal(t, 1, depth)
+	assert.Equal(t, "iso", path)
+	_, _, path = treeColumns(t, s, "/1.3.6.1")
+	assert.Equal(t, "iso.3.dod.internet", path)
+
+	save("/1", map[string]*models.TableInfo{"/1.3": {Name: "identified-organization, org"}})
+	_, _, path = treeColumns(t, s, "/1.3.6.1")
+	assert.Equal(t, "iso.identified-organization.dod.internet", path)
+
+	save("/1", map[string]*models.TableInfo{"/1.3": {Name: "org"}})
+	_, _, path = treeColumns(t, s, "/1.3")
+	assert.Equal(t, "iso.org", path)
+	_, _, path = treeColumns(t, s, "/1.3.6.1")
+	assert.Equal(t, "iso.org.dod.internet", path)
+
+	// names that are no identifiers go by their number
+	save("/1.3.6.1", map[string]*models.TableInfo{"/1.3.6.1.4": {Name: "Private Enterprises"}})
+	_, _, path = treeColumns(t, s, "/1.3.6.1.4")
+	assert.Equal(t, "iso.org.dod.internet.4", path)
+}
+
+func TestSqlDb_backfillTree(t *testing.T) {
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "old.sqlite"))
+	require.NoError(t, err)
+	defer db.Close()
+	_, err = db.Exec("CREATE TABLE mib (uid INTEGER not null constraint mib_pk primary key autoincrement," +
+		"oid VARCHAR(64) not null,name VARCHAR(64) not null,sub_ch INTEGER not null,sub_total INTEGER," +
+		"descr TEXT,inf TEXT default '-');" +
+		"INSERT INTO mib(oid, name, sub_ch) values('/1.3.6.1', 'internet', 0),('/1', 'iso', 1),('/1.3.6', 'dod', 1);")
+	require.NoError(t, err)
+
+	s := NewSqlDb(db)
+	require.NoError(t, s.Prepare())
+
+	parent, depth, path := treeColumns(t, s, "/1.3.6.1")
+	assert.Equal(t, "/1.3.6", parent)
+	assert.Equal(t, 4, depth)
+	assert.Equal(t, "iso.3.dod.internet", path)
+	parent, depth, path = treeColumns(t, s, "/1")
+	assert.Equal(t, "/", parent)
+	assert.Equal(t, 1, depth)
+	assert.Equal(t, "iso", path)
+}
@@ -0,0 +1,79 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"hello/scraper/models"
+	"time"
+)
+
+// History returns every version the record of oid went through, newest first.
+// The first entry is the current record. It is empty when oid is unknown.
+func (s *SqlDb) History(oid string) ([]*models.RecordVersion, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var versions []*models.RecordVersion
+	current := &models.RecordVersion{}
+	var runID, since, tombstoned, created, modified sql.NullInt64
+	var asn1, iri, dot, authority sql.NullString
+	err := s.db.QueryRow("SELECT m.name, m.sub_ch, COALESCE(m.sub_total, 0), COALESCE(m.descr, ''), "+
+		"COALESCE(m.inf, ''), m.run_id, r.started_at, m.tombstoned_at, m.asn1_notation, m.oid_iri, m.dot_notation, "+
+		"m.registration_authority, m.registered_at, m.registration_modified_at FROM mib m "+
+		"LEFT JOIN crawl_runs r ON r.id = m.run_id WHERE m.oid = ? ORDER BY m.uid LIMIT 1;", oid).
+		Scan(&current.Info.Name, &current.Info.SubCh, &current.Info.SubTotal, &current.Info.Desc, &current.Info.Inf,
+			&runID, &since, &tombstoned, &asn1, &iri, &dot, &authority, &created, &modified)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("cant look up oid %v: %v", oid, err)
+	}
+	current.RunID = runID.Int64
+	current.Since = unixTime(since)
+	current.TombstonedAt = unixTime(tombstoned)
+	if asn1.Valid || iri.Valid || dot.Valid || authority.Valid || created.Valid || modified.Valid {
+		current.Details = &models.OidDetails{ASN1: asn1.String, IRI: iri.String, Dot: dot.String,
+			Authority: authority.String, Created: unixTime(created), Modified: unixTime(modified)}
+	}
+	versions = append(versions, current)
+
+	rows, err := s.db.Query("SELECT h.name, h.sub_ch, COALESCE(h.sub_total, 0), COALESCE(h.descr, ''), "+
+		"COALESCE(h.inf, ''), h.run_id, r.started_at, h.replaced_at, COALESCE(h.replaced_by, 0) FROM mib_history h "+
+		"LEFT JOIN crawl_runs r ON r.id = h.run_id WHERE h.oid = ? ORDER BY h.replaced_at DESC, h.id DESC;", oid)
+	if err != nil {
+		return nil, fmt.Errorf("cant execute a history query: %v", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		version := &models.RecordVersion{}
+		var until int64
+		err = rows.Scan(&version.Info.Name, &version.Info.SubCh, &version.Info.SubTotal, &version.Info.Desc,
+			&version.Info.Inf, &runID, &since, &until, &version.ReplacedBy)
+		if err != nil {
+			return nil, fmt.Errorf("cant scan a history row: %v", err)
+		}
+		version.RunID = runID.Int64
+		version.Since = unixTime(since)
+		version.Until = time.Unix(until, 0)
+		versions = append(versions, version)
+	}
+
+	return versions, rows.Err()
+}
+
+// unixColumn stores t as unix seconds, the zero time as NULL.
+func unixColumn(t time.Time) sql.NullInt64 {
+	if t.IsZero() {
+		return sql.NullInt64{}
+	}
+	return sql.NullInt64{Int64: t.Unix(), Valid: true}
+}
+
+func unixTime(t sql.NullInt64) time.Time {
+	if !t.Valid {
+		return time.Time{}
+	}
+	return time.Unix(t.Int64, 0)
+}
@@ -0,0 +1,54 @@
+package database
+
+import (
+	"fmt"
+	"hello/scraper/models"
+	"time"
+)
+
+// StartRun records the start of a crawl run with the settings it runs with
+// and returns its id.
+func (s *SqlDb) StartRun(config string) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	res, err := s.db.Exec("INSERT INTO crawl_runs(started_at, config) values(?,?);", time.Now().Unix(), config)
+	if err != nil {
+		return 0, fmt.Errorf("cant execute a start run query: %v", err)
+	}
+
+	return res.LastInsertId()
+}
+
+// AbortRuns marks the runs that never finished aborted. Like
+// RecoverInFlight it is meant for the start of a crawl, when whoever ran them
+// is gone.
+func (s *SqlDb) AbortRuns() (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	res, err := s.db.Exec("UPDATE crawl_runs SET exit_reason = ? WHERE ended_at IS NULL AND exit_reason IS NULL;",
+		models.ExitAborted)
+	if err != nil {
+		return 0, fmt.Errorf("cant close aborted runs: %v", err)
+	}
+
+	return res.RowsAffected()
+}
+
+// FinishRun stores how run id ended.
+func (s *SqlDb) FinishRun(id int64, result *models.CrawlResult) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, err := s.db.Exec("UPDATE crawl_runs SET ended_at = ?, exit_reason = ?, pages_fetched = ?, pages_unchanged = ?, "+
+		"bytes_fetched = ?, records_inserted = ?, records_updated = ?, records_tombstoned = ?, failures = ?, "+
+		"released = ? WHERE id = ?;", time.Now().Unix(), result.ExitReason, result.PagesFetched, result.PagesUnchanged,
+		result.BytesFetched, result.RecordsInserted, result.RecordsUpdated, result.RecordsTombstoned, result.Failures,
+		result.Released, id)
+	if err != nil {
+		return fmt.Errorf("cant execute a finish run query: %v", err)
+	}
+
+	return nil
+}
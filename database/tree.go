@@ -0,0 +1,167 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"hello/scraper/models"
+	"log"
+	"strings"
+)
+
+// arcName is how oid shows up in name paths: the first of the names of its
+// record, or its number when that is no usable identifier.
+func arcName(oid, name string) string {
+	first := strings.TrimSpace(strings.SplitN(name, ",", 2)[0])
+	if first == "" || strings.ContainsAny(first, ". \t\r\n") {
+		return oid[strings.LastIndexAny(oid, "/.")+1:]
+	}
+	return first
+}
+
+func joinPath(parent, arc string) string {
+	if parent == "" {
+		return arc
+	}
+	return parent + "." + arc
+}
+
+// parentColumn is the parent of oid as stored, NULL for the root.
+func parentColumn(oid string) sql.NullString {
+	parent := models.Parent(oid)
+	return sql.NullString{String: parent, Valid: parent != ""}
+}
+
+// pathOf returns the name path of oid, like "iso.org.dod". Arcs without a
+// record are filled in with their numbers.
+func pathOf(tx *sql.Tx, oid string) (string, error) {
+	if oid == "/" {
+		return "", nil
+	}
+
+	var path sql.NullString
+	err := tx.QueryRow("SELECT name_path FROM mib WHERE oid = ? ORDER BY uid LIMIT 1;", oid).Scan(&path)
+	if err != nil && err != sql.ErrNoRows {
+		return "", fmt.Errorf("cant look up name path of %v: %v", oid, err)
+	}
+	if path.Valid {
+		return path.String, nil
+	}
+
+	parent, err := pathOf(tx, models.Parent(oid))
+	if err != nil {
+		return "", err
+	}
+	return joinPath(parent, arcName(oid, "")), nil
+}
+
+// namePath is the name path of oid once its record is named name.
+func namePath(tx *sql.Tx, oid, name string) (string, error) {
+	parent, err := pathOf(tx, models.Parent(oid))
+	if err != nil {
+		return "", err
+	}
+	return joinPath(parent, arcName(oid, name)), nil
+}
+
+// renamePath moves the name paths of the records below oid over from
+// oldPath to newPath, when oid got a record or its name changed.
+func renamePath(tx *sql.Tx, oid, oldPath, newPath string) error {
+	if oldPath == newPath {
+		return nil
+	}
+
+	cond, args := underClause(oid)
+	args = append([]interface{}{newPath, oldPath}, args...)
+	_, err := tx.Exec("UPDATE mib SET name_path = ? || substr(name_path, length(?) + 1) WHERE "+cond+
+		" AND oid != ? AND substr(name_path, 1, length(?) + 1) = ?;",
+		append(args, oid, oldPath, oldPath+".")...)
+	if err != nil {
+		return fmt.Errorf("cant rename the name paths below %v: %v", oid, err)
+	}
+
+	return nil
+}
+
+// backfillTree fills in parent, depth and name_path of the records stored
+// before those columns existed.
+func (s *SqlDb) backfillTree() error {
+	var missing int
+	err := s.db.QueryRow("SELECT count(*) FROM mib WHERE depth IS NULL;").Scan(&missing)
+	if err != nil {
+		return fmt.Errorf("cant count records to backfill: %v", err)
+	}
+	if missing == 0 {
+		return nil
+	}
+
+	rows, err := s.db.Query("SELECT uid, oid, name, depth IS NULL FROM mib ORDER BY uid;")
+	if err != nil {
+		return fmt.Errorf("cant read records to backfill: %v", err)
+	}
+	arcs := make(map[string]string)
+	backfill := make(map[int64]string, missing)
+	for rows.Next() {
+		var uid int64
+		var oid, name string
+		var empty bool
+		err = rows.Scan(&uid, &oid, &name, &empty)
+		if err != nil {
+			rows.Close()
+			return fmt.Errorf("cant scan a record to backfill: %v", err)
+		}
+		if _, ok := arcs[oid]; !ok {
+			arcs[oid] = arcName(oid, name)
+		}
+		if empty {
+			backfill[uid] = oid
+		}
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return fmt.Errorf("cant read records to backfill: %v", err)
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("cant begin a transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	for uid, oid := range backfill {
+		path := ""
+		for _, ancestor := range ancestors(oid) {
+			arc, ok := arcs[ancestor]
+			if !ok {
+				arc = arcName(ancestor, "")
+			}
+			path = joinPath(path, arc)
+		}
+		_, err = tx.Exec("UPDATE mib SET parent = ?, depth = ?, name_path = ? WHERE uid = ?;",
+			parentColumn(oid), models.Depth(oid), path, uid)
+		if err != nil {
+			return fmt.Errorf("cant backfill oid %v: %v", oid, err)
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return fmt.Errorf("cant commit backfill: %v", err)
+	}
+
+	log.Printf("Backfilled parent, depth and name path of %d records", len(backfill))
+	return nil
+}
+
+// ancestors lists the oids from the top level arc of oid down to oid itself.
+func ancestors(oid string) []string {
+	if oid == "/" {
+		return nil
+	}
+	var oids []string
+	for i, c := range oid {
+		if c == '.' {
+			oids = append(oids, oid[:i])
+		}
+	}
+	return append(oids, oid)
+}
@@ -1,53 +1,367 @@
 package main
 
 import (
+	"context"
 	"database/sql"
+	"encoding/json"
 	"flag"
+	"fmt"
 	_ "github.com/mattn/go-sqlite3"
 	"hello/scraper/database"
+	"hello/scraper/models"
 	"hello/scraper/scrapers"
+	"hello/scraper/warc"
 	"log"
 	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
 )
 
 var (
-	env *string
+	env          *string
+	leaseTimeout *time.Duration
+	maxAttempts  *int
+	rps          *float64
+	burst        *int
+	jitter       *time.Duration
+	maxConns     *int
+	robots       *bool
+	agent        *string
+	retries      *int
+	backoff      *time.Duration
+	maxBackoff   *time.Duration
+	breakerFails *int
+	cooldown     *time.Duration
+	status       *time.Duration
+	roots        *string
+	maxDepth     *int
+	exclude      *string
+	walkers      *int
+	digesters    *int
+	adaptive     *bool
+	minWalkers   *int
+	maxWalkers   *int
+	maxDigesters *int
+	latency      *time.Duration
+	errorRate    *float64
+	refresh      *bool
+	staleAfter   *time.Duration
+	subtreeTTL   *string
+	archive      *bool
+	warcDir      *string
+	warcSize     *int64
+	replay       *string
+	strict       *bool
+	maxPages     *int64
+	maxBytes     *int64
+	maxDuration  *time.Duration
+	maxRecords   *int64
+	interval     *time.Duration
+	cronExpr     *string
 )
 
 func init() {
 	env = flag.String("output", "mibs.sqlite", "data source name")
+	leaseTimeout = flag.Duration("lease", 10*time.Minute, "how long a url may stay in flight before it is handed out again")
+	maxAttempts = flag.Int("attempts", 3, "how many times a url is fetched before it is marked failed, retries included")
+	rps = flag.Float64("rps", 1, "requests per second allowed per host, 0 for no limit")
+	burst = flag.Int("burst", 1, "requests allowed per host back to back before the rate limit applies")
+	jitter = flag.Duration("jitter", 500*time.Millisecond, "upper bound of the random delay added before every request")
+	maxConns = flag.Int("conns", 2, "concurrent connections allowed per host, 0 for no limit")
+	robots = flag.Bool("robots", true, "honor robots.txt of the crawled host")
+	agent = flag.String("agent", "oidscraper", "user agent sent with every request and looked up in robots.txt")
+	retries = flag.Int("retries", 5, "how many times a failed fetch is retried before the url is given back to the frontier, counted against -attempts")
+	backoff = flag.Duration("backoff", time.Second, "backoff before the first retry, doubled for every retry after it")
+	maxBackoff = flag.Duration("max-backoff", 2*time.Minute, "upper bound for the backoff and for Retry-After")
+	breakerFails = flag.Int("breaker-failures", 10, "failed requests in a row that pause all fetching, 0 to never pause")
+	cooldown = flag.Duration("breaker-cooldown", time.Minute, "how long fetching is paused before a probe request is let through")
+	status = flag.Duration("status", 30*time.Second, "how often progress is logged, 0 to never log it")
+	roots = flag.String("roots", "/", "comma separated oids whose subtrees are crawled, e.g. 1.3.6.1.2.1,1.3.6.1.4.1")
+	maxDepth = flag.Int("depth", 0, "how many levels below each root are crawled, 0 for no limit")
+	exclude = flag.String("exclude", "", "comma separated oids whose subtrees are skipped")
+	walkers = flag.Int("walkers", 5, "concurrent page fetchers, the starting number with -adaptive")
+	digesters = flag.Int("digesters", 5, "concurrent database writers, the starting number with -adaptive")
+	adaptive = flag.Bool("adaptive", false, "resize the walker and digester pools by fetch latency, error rate and write queue depth")
+	minWalkers = flag.Int("min-walkers", 1, "fewest walkers -adaptive shrinks to")
+	maxWalkers = flag.Int("max-walkers", 20, "most walkers -adaptive grows to")
+	maxDigesters = flag.Int("max-digesters", 10, "most digesters -adaptive grows to")
+	latency = flag.Duration("target-latency", 5*time.Second, "average fetch time above which -adaptive takes walkers away")
+	errorRate = flag.Float64("max-error-rate", 0.2, "share of failed fetches above which -adaptive takes walkers away")
+	refresh = flag.Bool("refresh", false, "fetch pages crawled before again, using conditional requests")
+	staleAfter = flag.Duration("stale", 0, "how long a fetched page stays fresh before a refresh fetches it again, "+
+		"weighted by depth and number of descendants; 0 refreshes every page")
+	subtreeTTL = flag.String("subtree-ttl", "", "comma separated oid=duration pairs overriding -stale for subtrees, "+
+		"e.g. 1.3.6.1.4.1=168h")
+	archive = flag.Bool("archive", true, "keep the html of every fetched page, gzipped and stored once per content")
+	warcDir = flag.String("warc", "", "directory to write every request and response to as gzipped WARC files, "+
+		"empty to write none")
+	warcSize = flag.Int64("warc-size", 1<<30, "size in bytes after which a new WARC file is started")
+	replay = flag.String("replay", "", "answer requests from recordings instead of the network: \"archive\" for the "+
+		"page archive or a directory of WARC files; turns off politeness, robots.txt, archiving and -warc")
+	strict = flag.Bool("strict", false, "with -replay, stop the crawl at the first url without a recording instead of "+
+		"treating it as not found")
+	maxPages = flag.Int64("max-pages", 0, "pages a run fetches at most before it stops, 0 for no limit")
+	maxBytes = flag.Int64("max-bytes", 0, "response bytes a run fetches at most before it stops, 0 for no limit")
+	maxDuration = flag.Duration("max-duration", 0, "how long a run goes on at most before it stops, 0 for no limit")
+	maxRecords = flag.Int64("max-records", 0, "new records a run inserts at most before it stops, 0 for no limit")
+	interval = flag.Duration("interval", 24*time.Hour, "how often the daemon starts a refresh cycle")
+	cronExpr = flag.String("cron", "", "cron expression for the daemon cycles, e.g. \"30 3 * * *\"; overrides -interval")
 }
 
 func main() {
+	flag.Usage = usage
 	flag.Parse()
+	err := run()
+	if err != nil {
+		log.Printf("%v", err)
+		os.Exit(1)
+	}
+}
+
+// run carries out the command, so its deferred calls are done before main
+// exits.
+func run() error {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		// a second signal kills a slow shutdown
+		<-ctx.Done()
+		stop()
+	}()
+
 	db, err := sql.Open("sqlite3", *env)
 	if err != nil {
-		log.Printf("could not connect to database: %v", err)
-		return
+		return fmt.Errorf("could not connect to database: %v", err)
 	}
+	defer db.Close()
 
 	sqlDb := database.NewSqlDb(db)
 	err = sqlDb.Prepare()
 	if err != nil {
-		log.Printf("could not prepare database: %v", err)
-		return
+		return fmt.Errorf("could not prepare database: %v", err)
+	}
+
+	switch command := flag.Arg(0); command {
+	case "", "crawl":
+		err = crawl(ctx, sqlDb)
+	case "daemon":
+		err = daemon(ctx, sqlDb)
+	case "overdue":
+		err = overdue(sqlDb)
+	case "reparse":
+		err = reparse(ctx, sqlDb, flag.Args()[1:])
+	case "import-warc":
+		err = importWARC(sqlDb, flag.Args()[1:])
+	case "archive":
+		err = listArchive(sqlDb, flag.Args()[1:])
+	case "history":
+		err = history(sqlDb, flag.Args()[1:])
+	default:
+		flag.Usage()
+		err = fmt.Errorf("unknown command %q", command)
+	}
+	if err != nil {
+		return fmt.Errorf("%v: %v", flag.Arg(0), err)
+	}
+	return nil
+}
+
+func usage() {
+	fmt.Fprintf(flag.CommandLine.Output(), `Usage: %s [flags] [command]
+
+Commands:
+  crawl          crawl oidref.com into the database (default)
+  daemon         refresh stale pages in cycles per -interval or -cron until stopped
+  history <oid>  show how the record of oid changed over time
+  overdue        list the pages due for a refresh, most overdue first
+  archive <oid>  list the archived fetches of the page of oid
+  reparse [oid]  parse the archived pages under oid, or in -roots, again and save what changed
+  import-warc <file>...
+                 add the oid pages recorded in WARC files to the archive
+
+Flags:
+`, os.Args[0])
+	flag.PrintDefaults()
+}
+
+func crawl(ctx context.Context, sqlDb *database.SqlDb) error {
+	client, closeWARC, err := newClient(sqlDb)
+	if err != nil {
+		return err
+	}
+	defer closeWARC()
+	scraper, err := newScraper(sqlDb, client, *refresh)
+	if err != nil {
+		return err
+	}
+	_, err = scraper.Start(ctx)
+	if err != nil {
+		return fmt.Errorf("scraper stopped: %v", err)
+	}
+	return nil
+}
+
+// daemon refreshes the stale pages every cycle, until ctx is done.
+func daemon(ctx context.Context, sqlDb *database.SqlDb) error {
+	var schedule scrapers.Schedule = scrapers.Interval(*interval)
+	if *cronExpr != "" {
+		cron, err := scrapers.ParseCron(*cronExpr)
+		if err != nil {
+			return err
+		}
+		schedule = cron
+	} else if *interval <= 0 {
+		return fmt.Errorf("interval has to be positive, got %v", *interval)
 	}
 
-	oid, err := sqlDb.GetLastOidCache()
+	client, closeWARC, err := newClient(sqlDb)
 	if err != nil {
-		log.Printf("could not get last added oid: %v", err)
+		return err
 	}
-	urlCache, err := sqlDb.FillCache()
+	defer closeWARC()
+	scraper, err := newScraper(sqlDb, client, true)
 	if err != nil {
-		log.Printf("could not fill cache: %v", err)
+		return err
 	}
+	return scrapers.NewDaemon(scraper, schedule).Run(ctx)
+}
+
+// newClient returns the client requests go out through: a replay of
+// recordings with -replay, otherwise the network, recorded when -warc is
+// set. The func returned closes the WARC file.
+func newClient(sqlDb *database.SqlDb) (scrapers.HTTPClient, func(), error) {
+	switch {
+	case *replay == "archive":
+		return scrapers.NewReplayClient(scrapers.NewArchiveRecordings(sqlDb), *strict), func() {}, nil
+	case *replay != "":
+		recordings, err := scrapers.LoadWARCRecordings(*replay)
+		if err != nil {
+			return nil, nil, err
+		}
+		return scrapers.NewReplayClient(recordings, *strict), func() {}, nil
+	case *warcDir == "":
+		return http.DefaultClient, func() {}, nil
+	}
+
+	recorder := warc.NewFileWriter(*warcDir, "oidscraper", *warcSize)
+	return scrapers.NewRecordingClient(http.DefaultClient, recorder), func() {
+		err := recorder.Close()
+		if err != nil {
+			log.Printf("could not close warc file: %v", err)
+		}
+	}, nil
+}
+
+func newScraper(sqlDb *database.SqlDb, base scrapers.HTTPClient, refresh bool) (*scrapers.OIDScraper, error) {
+	ttl, err := newTTL()
+	if err != nil {
+		return nil, err
+	}
+
+	// a replay does not touch the site, so there is nobody to be polite to
+	replaying := *replay != ""
+	politeness := scrapers.PolitenessConfig{
+		RequestsPerSecond: *rps,
+		Burst:             *burst,
+		Jitter:            *jitter,
+		MaxConnsPerHost:   *maxConns,
+	}
+	if replaying {
+		politeness = scrapers.PolitenessConfig{}
+	}
+	polite := scrapers.NewPoliteClient(base, politeness)
+	client := scrapers.NewCircuitBreaker(polite, *breakerFails, *cooldown)
+	var robotsChecker scrapers.RobotsChecker
+	if *robots && !replaying {
+		robotsChecker = scrapers.NewRobots(client, *agent, polite)
+	}
+	parser := scrapers.NewOIDParser(client, *agent, robotsChecker, scrapers.RetryPolicy{
+		MaxRetries:  *retries,
+		MaxAttempts: *maxAttempts,
+		BaseDelay:   *backoff,
+		MaxDelay:    *maxBackoff,
+	})
+	var adaptiveConfig *scrapers.AdaptiveConfig
+	if *adaptive {
+		adaptiveConfig = &scrapers.AdaptiveConfig{
+			MinWalkers:    *minWalkers,
+			MaxWalkers:    *maxWalkers,
+			MinDigesters:  1,
+			MaxDigesters:  *maxDigesters,
+			Interval:      10 * time.Second,
+			TargetLatency: *latency,
+			MaxErrorRate:  *errorRate,
+		}
+	}
+	return scrapers.NewOIDScraper(sqlDb, parser, scrapers.Config{
+		Scope:          newScope(),
+		LeaseTimeout:   *leaseTimeout,
+		MaxAttempts:    *maxAttempts,
+		Refresh:        refresh,
+		TTL:            ttl,
+		Archive:        *archive && !replaying,
+		Walkers:        *walkers,
+		Digesters:      *digesters,
+		Adaptive:       adaptiveConfig,
+		StatusInterval: *status,
+		Reporters:      []scrapers.StatusReporter{client},
+		Budget: &scrapers.Budget{
+			MaxPages:      *maxPages,
+			MaxBytes:      *maxBytes,
+			MaxDuration:   *maxDuration,
+			MaxNewRecords: *maxRecords,
+		},
+		RunConfig: flagsJSON(),
+	}), nil
+}
+
+func newScope() *models.Scope {
+	return models.NewScope(splitList(*roots), *maxDepth, splitList(*exclude))
+}
+
+// newTTL reads -stale and the oid=duration pairs of -subtree-ttl.
+func newTTL() (*models.TTL, error) {
+	subtrees := make(map[string]time.Duration)
+	for _, pair := range splitList(*subtreeTTL) {
+		i := strings.Index(pair, "=")
+		if i < 0 {
+			return nil, fmt.Errorf("cant parse subtree ttl %q: expected oid=duration", pair)
+		}
+		d, err := time.ParseDuration(strings.TrimSpace(pair[i+1:]))
+		if err != nil {
+			return nil, fmt.Errorf("cant parse subtree ttl %q: %v", pair, err)
+		}
+		subtrees[strings.TrimSpace(pair[:i])] = d
+	}
+
+	return models.NewTTL(*staleAfter, subtrees), nil
+}
+
+// splitList splits a comma separated flag value, dropping empty entries.
+func splitList(value string) []string {
+	var list []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
 
-	parser := scrapers.NewOIDParser(urlCache, http.DefaultClient)
-	scraper := scrapers.NewOIDScraper(oid, urlCache, sqlDb, parser)
+// flagsJSON describes the settings of this process for its run records.
+func flagsJSON() string {
+	settings := make(map[string]string)
+	flag.VisitAll(func(f *flag.Flag) {
+		settings[f.Name] = f.Value.String()
+	})
 
-	err = scraper.Start()
+	data, err := json.Marshal(settings)
 	if err != nil {
-		log.Fatalf("scraper stopped: %v", err)
+		log.Printf("could not describe settings: %v", err)
+		return ""
 	}
-	return
+	return string(data)
 }
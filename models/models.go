@@ -1,5 +1,7 @@
 package models
 
+import "time"
+
 type TableInfo struct {
 	Name     string
 	SubCh    int
@@ -7,3 +9,124 @@ type TableInfo struct {
 	Desc     string
 	Inf      string
 }
+
+// OidDetails is the registration metadata an oid's own page lists: its
+// ASN.1 notation like "{iso(1) identified-organization(3)}", OID-IRI like
+// "/ISO/Identified-Organization", dot notation like "1.3", who registered
+// it and when. Dates the page leaves out are zero.
+type OidDetails struct {
+	ASN1      string
+	IRI       string
+	Dot       string
+	Authority string
+	Created   time.Time
+	Modified  time.Time
+}
+
+// Frontier states a url goes through while it is crawled.
+const (
+	StatePending  = "pending"
+	StateInFlight = "in_flight"
+	StateDone     = "done"
+	StateFailed   = "failed"
+)
+
+// FrontierItem is a url leased from the crawl frontier. ETag and
+// LastModified are the validators of its last successful fetch, if any.
+type FrontierItem struct {
+	Oid          string
+	Attempts     int
+	ETag         string
+	LastModified string
+}
+
+// Page is what a walker got out of a single frontier url. Links holds every
+// oid found on the page and Records what the page says about them. Children
+// lists the direct children of Oid the page shows, in scope or not; it is
+// left empty when the page had malformed rows and may be incomplete.
+// Siblings lists the other children of its parent the page shows as its
+// brothers, Details what it says about Oid itself, if anything. URL and Body
+// are what was fetched; Body is nil when it is not to be archived. Unchanged
+// is set when the server answered that the page did not change since the
+// last fetch, Err when it could not be fetched or parsed. Retries is how
+// often it was fetched again after failing, Elapsed the time spent fetching
+// it.
+type Page struct {
+	Oid          string
+	Links        []string
+	Records      map[string]*TableInfo
+	Children     []string
+	Siblings     []string
+	Details      *OidDetails
+	URL          string
+	Body         []byte
+	ETag         string
+	LastModified string
+	Unchanged    bool
+	Err          error
+	Retries      int
+	Elapsed      time.Duration
+}
+
+// SaveResult lists the records a saved page inserted or changed, the
+// children its page no longer shows and the siblings its parent page did not
+// list although it was fetched.
+type SaveResult struct {
+	Inserted   []string
+	Updated    []string
+	Tombstoned []string
+	Unlisted   []string
+}
+
+// Reasons a crawl can end with.
+const (
+	ExitCompleted   = "completed"
+	ExitInterrupted = "interrupted"
+	ExitError       = "error"
+	// ExitAborted marks runs whose process died before it could finish them.
+	ExitAborted = "aborted"
+	// ExitBudget marks runs stopped by one of their limits.
+	ExitBudget = "budget"
+)
+
+// CrawlResult sums up a finished crawl.
+type CrawlResult struct {
+	RunID           int64
+	PagesFetched    int64
+	PagesUnchanged  int64
+	BytesFetched    int64
+	RecordsInserted int64
+	RecordsUpdated  int64
+	// RecordsTombstoned counts the records whose oid vanished from its parent page.
+	RecordsTombstoned int64
+	Failures          int64
+	Released          int64
+	Duration          time.Duration
+	ExitReason        string
+}
+
+// RecordVersion is the record of an oid as one run wrote it. Since is when
+// that run started; Until and ReplacedBy are zero for the current version.
+// TombstonedAt is set on the current version once the oid vanished from
+// its parent page, Details once its own page was read.
+type RecordVersion struct {
+	Info         TableInfo
+	Details      *OidDetails
+	RunID        int64
+	Since        time.Time
+	Until        time.Time
+	ReplacedBy   int64
+	TombstonedAt time.Time
+}
+
+// ArchivedPage is a single archived fetch of a page. Body is only filled in
+// when it was asked for.
+type ArchivedPage struct {
+	Oid       string
+	URL       string
+	FetchedAt time.Time
+	Hash      string
+	RunID     int64
+	Size      int
+	Body      []byte
+}
@@ -0,0 +1,91 @@
+package models
+
+import "strings"
+
+// Scope limits a crawl to the subtrees under Roots, at most MaxDepth levels
+// below each root and outside of the subtrees under Exclude. A zero MaxDepth
+// means no limit. Oids are in the "/1.3.6.1" form used for urls.
+type Scope struct {
+	Roots    []string
+	MaxDepth int
+	Exclude  []string
+}
+
+// NewScope normalizes roots and exclusions. Without roots the whole tree is
+// in scope.
+func NewScope(roots []string, maxDepth int, exclude []string) *Scope {
+	scope := &Scope{MaxDepth: maxDepth}
+	for _, root := range roots {
+		scope.Roots = append(scope.Roots, NormalizeOid(root))
+	}
+	if len(scope.Roots) == 0 {
+		scope.Roots = []string{"/"}
+	}
+	for _, oid := range exclude {
+		scope.Exclude = append(scope.Exclude, NormalizeOid(oid))
+	}
+
+	return scope
+}
+
+// Contains reports whether the record of oid belongs to the crawl. A nil
+// scope contains everything.
+func (s *Scope) Contains(oid string) bool {
+	return s.within(oid, 0)
+}
+
+// Follow reports whether the page of oid should be fetched, which is the
+// case when its children are still in scope.
+func (s *Scope) Follow(oid string) bool {
+	return s.within(oid, 1)
+}
+
+func (s *Scope) within(oid string, slack int) bool {
+	if s == nil {
+		return true
+	}
+	for _, ex := range s.Exclude {
+		if IsUnder(oid, ex) {
+			return false
+		}
+	}
+	for _, root := range s.Roots {
+		if IsUnder(oid, root) && (s.MaxDepth <= 0 || Depth(oid)-Depth(root)+slack <= s.MaxDepth) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// NormalizeOid turns "1.3.6.1" or "/1.3.6.1/" into "/1.3.6.1".
+func NormalizeOid(oid string) string {
+	return "/" + strings.Trim(strings.TrimSpace(oid), "/.")
+}
+
+// Depth is the number of arcs in oid, zero for the root.
+func Depth(oid string) int {
+	if oid == "/" {
+		return 0
+	}
+	return strings.Count(oid, ".") + 1
+}
+
+// Parent returns the oid one arc up, "/" for top level arcs and "" for the root.
+func Parent(oid string) string {
+	if oid == "/" {
+		return ""
+	}
+	if i := strings.LastIndex(oid, "."); i >= 0 {
+		return oid[:i]
+	}
+	return "/"
+}
+
+// IsUnder reports whether oid is root or one of its descendants.
+func IsUnder(oid, root string) bool {
+	if root == "/" {
+		return strings.HasPrefix(oid, "/")
+	}
+	return oid == root || strings.HasPrefix(oid, root+".")
+}
@@ -0,0 +1,58 @@
+package models
+
+import (
+	"math"
+	"time"
+)
+
+// TTL decides how long a fetched page counts as fresh before a refresh
+// fetches it again. Subtrees overrides Default for the oids under each key,
+// the deepest matching subtree wins.
+type TTL struct {
+	Default  time.Duration
+	Subtrees map[string]time.Duration
+}
+
+// OverdueOid is a page whose TTL ran out.
+type OverdueOid struct {
+	Oid         string
+	LastFetched time.Time
+	TTL         time.Duration
+	DueAt       time.Time
+}
+
+// NewTTL normalizes the subtree oids.
+func NewTTL(def time.Duration, subtrees map[string]time.Duration) *TTL {
+	ttl := &TTL{Default: def, Subtrees: make(map[string]time.Duration, len(subtrees))}
+	for oid, d := range subtrees {
+		ttl.Subtrees[NormalizeOid(oid)] = d
+	}
+
+	return ttl
+}
+
+// Base is the TTL configured for the subtree oid is in.
+func (t *TTL) Base(oid string) time.Duration {
+	base, depth := t.Default, -1
+	for root, d := range t.Subtrees {
+		if IsUnder(oid, root) && Depth(root) > depth {
+			base, depth = d, Depth(root)
+		}
+	}
+
+	return base
+}
+
+// For weights the base TTL of oid by how busy the node is: shallow nodes
+// with many descendants go stale sooner than deep leaves. The weight is
+// (1 + depth) / (1 + log10(1 + subTotal)), kept between 1/4 and 4. A nil
+// TTL makes every page stale right away.
+func (t *TTL) For(oid string, subTotal int) time.Duration {
+	if t == nil {
+		return 0
+	}
+
+	weight := float64(1+Depth(oid)) / (1 + math.Log10(1+float64(subTotal)))
+	weight = math.Max(0.25, math.Min(4, weight))
+	return time.Duration(float64(t.Base(oid)) * weight)
+}
@@ -0,0 +1,200 @@
+package scrapers
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Circuit breaker states.
+const (
+	BreakerClosed   = "closed"
+	BreakerOpen     = "open"
+	BreakerHalfOpen = "half-open"
+)
+
+// CircuitBreaker wraps an HTTPClient shared by all walkers. After Threshold
+// failed requests in a row it opens and holds every request back. Once the
+// cooldown has passed a single probe goes through (half-open); if it
+// succeeds everyone resumes, otherwise the breaker opens again.
+//
+// Network errors, 429 and 5xx answers count as failures, anything else as
+// a success.
+type CircuitBreaker struct {
+	client    HTTPClient
+	threshold int
+	cooldown  time.Duration
+
+	mu       sync.Mutex
+	state    string
+	failures int
+	openedAt time.Time
+	probing  bool
+	// changed is closed and replaced on every state change to wake waiters up.
+	changed chan struct{}
+}
+
+func NewCircuitBreaker(client HTTPClient, threshold int, cooldown time.Duration) *CircuitBreaker {
+	return &CircuitBreaker{
+		client:    client,
+		threshold: threshold,
+		cooldown:  cooldown,
+		state:     BreakerClosed,
+		changed:   make(chan struct{}),
+	}
+}
+
+func (b *CircuitBreaker) Do(req *http.Request) (*http.Response, error) {
+	probe, err := b.admit(req)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := b.client.Do(req)
+	if err != nil && req.Context().Err() != nil {
+		// a cancelled request says nothing about the host
+		b.abandon(probe)
+		return resp, err
+	}
+	b.record(probe, !breakerFailure(resp, err))
+
+	return resp, err
+}
+
+// State returns the current state of the breaker.
+func (b *CircuitBreaker) State() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.state
+}
+
+// Status describes the breaker for the status line of the scraper.
+func (b *CircuitBreaker) Status() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state == BreakerOpen {
+		retryIn := b.cooldown - time.Since(b.openedAt)
+		if retryIn < 0 {
+			retryIn = 0
+		}
+		return fmt.Sprintf("circuit breaker open, probing in %v", retryIn.Round(time.Second))
+	}
+	return fmt.Sprintf("circuit breaker %v, %d failures in a row", b.state, b.failures)
+}
+
+// admit blocks while the breaker is open or another request is probing. It
+// reports whether the caller is the probe.
+func (b *CircuitBreaker) admit(req *http.Request) (bool, error) {
+	ctx := req.Context()
+	for {
+		b.mu.Lock()
+		var wait time.Duration
+		switch b.state {
+		case BreakerClosed:
+			b.mu.Unlock()
+			return false, nil
+		case BreakerOpen:
+			wait = b.cooldown - time.Since(b.openedAt)
+			if wait <= 0 {
+				b.setState(BreakerHalfOpen)
+				b.probing = true
+				b.mu.Unlock()
+				return true, nil
+			}
+		case BreakerHalfOpen:
+			if !b.probing {
+				b.probing = true
+				b.mu.Unlock()
+				return true, nil
+			}
+		}
+		changed := b.changed
+		b.mu.Unlock()
+
+		var timer *time.Timer
+		var timeout <-chan time.Time
+		if wait > 0 {
+			timer = time.NewTimer(wait)
+			timeout = timer.C
+		}
+		select {
+		case <-changed:
+		case <-timeout:
+		case <-ctx.Done():
+		}
+		if timer != nil {
+			timer.Stop()
+		}
+		if ctx.Err() != nil {
+			return false, ctx.Err()
+		}
+	}
+}
+
+// abandon lets someone else probe when the probe was cancelled.
+func (b *CircuitBreaker) abandon(probe bool) {
+	if !probe {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.probing = false
+	b.broadcast()
+}
+
+func (b *CircuitBreaker) record(probe bool, ok bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if probe {
+		b.probing = false
+		if ok {
+			b.failures = 0
+			b.setState(BreakerClosed)
+		} else {
+			b.openedAt = time.Now()
+			b.setState(BreakerOpen)
+		}
+		return
+	}
+
+	if ok {
+		b.failures = 0
+		return
+	}
+	b.failures++
+	if b.state == BreakerClosed && b.threshold > 0 && b.failures >= b.threshold {
+		b.openedAt = time.Now()
+		b.setState(BreakerOpen)
+	}
+}
+
+// setState must be called with mu held.
+func (b *CircuitBreaker) setState(state string) {
+	if state == BreakerOpen {
+		log.Printf("Circuit breaker %v -> %v after %d failures in a row, pausing all fetches for %v",
+			b.state, state, b.failures, b.cooldown)
+	} else {
+		log.Printf("Circuit breaker %v -> %v", b.state, state)
+	}
+	b.state = state
+	b.broadcast()
+}
+
+// broadcast wakes up everyone waiting in admit. It must be called with mu held.
+func (b *CircuitBreaker) broadcast() {
+	close(b.changed)
+	b.changed = make(chan struct{})
+}
+
+func breakerFailure(resp *http.Response, err error) bool {
+	if err != nil {
+		return true
+	}
+	return resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500
+}
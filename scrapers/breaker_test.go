@@ -0,0 +1,103 @@
+package scrapers
+
+import (
+	"context"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type httpClientFunc func(*http.Request) (*http.Response, error)
+
+func (f httpClientFunc) Do(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	var down int32 = 1
+	var calls int32
+	client := httpClientFunc(func(*http.Request) (*http.Response, error) {
+		atomic.AddInt32(&calls, 1)
+		if atomic.LoadInt32(&down) == 1 {
+			return nil, errors.New("connection refused")
+		}
+		return &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(strings.NewReader(""))}, nil
+	})
+	breaker := NewCircuitBreaker(client, 3, 50*time.Millisecond)
+	req, _ := http.NewRequest("GET", baseUrl, nil)
+
+	for i := 0; i < 3; i++ {
+		_, err := breaker.Do(req)
+		assert.Error(t, err)
+	}
+	assert.Equal(t, BreakerOpen, breaker.State())
+
+	// held back while open, then the probe fails and it opens again
+	started := time.Now()
+	_, err := breaker.Do(req)
+	assert.Error(t, err)
+	assert.GreaterOrEqual(t, time.Since(started), 40*time.Millisecond)
+	assert.Equal(t, BreakerOpen, breaker.State())
+	assert.Equal(t, int32(4), atomic.LoadInt32(&calls))
+
+	atomic.StoreInt32(&down, 0)
+	_, err = breaker.Do(req)
+	require.NoError(t, err)
+	assert.Equal(t, BreakerClosed, breaker.State())
+}
+
+func TestCircuitBreaker_SingleProbe(t *testing.T) {
+	var calls int32
+	release := make(chan struct{})
+	client := httpClientFunc(func(*http.Request) (*http.Response, error) {
+		if atomic.AddInt32(&calls, 1) == 1 {
+			return nil, errors.New("connection refused")
+		}
+		<-release
+		return &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(strings.NewReader(""))}, nil
+	})
+	breaker := NewCircuitBreaker(client, 1, time.Millisecond)
+	req, _ := http.NewRequest("GET", baseUrl, nil)
+	_, _ = breaker.Do(req)
+	time.Sleep(5 * time.Millisecond)
+
+	done := make(chan struct{})
+	for i := 0; i < 3; i++ {
+		go func() {
+			_, _ = breaker.Do(req)
+			done <- struct{}{}
+		}()
+	}
+
+	time.Sleep(20 * time.Millisecond)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&calls))
+	assert.Equal(t, BreakerHalfOpen, breaker.State())
+
+	close(release)
+	for i := 0; i < 3; i++ {
+		<-done
+	}
+	assert.Equal(t, int32(4), atomic.LoadInt32(&calls))
+	assert.Equal(t, BreakerClosed, breaker.State())
+}
+
+func TestCircuitBreaker_Cancelled(t *testing.T) {
+	client := httpClientFunc(func(*http.Request) (*http.Response, error) {
+		return nil, errors.New("connection refused")
+	})
+	breaker := NewCircuitBreaker(client, 1, time.Hour)
+	req, _ := http.NewRequest("GET", baseUrl, nil)
+	_, _ = breaker.Do(req)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err := breaker.Do(req.WithContext(ctx))
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Contains(t, breaker.Status(), "circuit breaker open")
+}
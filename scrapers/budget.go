@@ -0,0 +1,42 @@
+package scrapers
+
+import (
+	"fmt"
+	"hello/scraper/models"
+	"sync/atomic"
+	"time"
+)
+
+// Budget caps a single crawl. Zero leaves a limit off. Once a limit is hit
+// the crawl stops the way it does when interrupted: pages already fetched
+// are saved and everything else stays in the frontier for the next run.
+type Budget struct {
+	// MaxPages is how many urls are handed out for fetching. The crawl
+	// waits for the last of them to be saved before it stops.
+	MaxPages int64
+	// MaxBytes caps the size of the response bodies fetched.
+	MaxBytes int64
+	// MaxDuration caps the wall-clock time of the crawl.
+	MaxDuration time.Duration
+	// MaxNewRecords caps the records inserted.
+	MaxNewRecords int64
+}
+
+// pagesLeft reports whether another url may be handed out after leased ones.
+func (b *Budget) pagesLeft(leased int64) bool {
+	return b == nil || b.MaxPages <= 0 || leased < b.MaxPages
+}
+
+// spent returns the limit result has reached, or "" when there is none.
+func (b *Budget) spent(result *models.CrawlResult) string {
+	if b == nil {
+		return ""
+	}
+	if bytes := atomic.LoadInt64(&result.BytesFetched); b.MaxBytes > 0 && bytes >= b.MaxBytes {
+		return fmt.Sprintf("%d bytes fetched", bytes)
+	}
+	if records := atomic.LoadInt64(&result.RecordsInserted); b.MaxNewRecords > 0 && records >= b.MaxNewRecords {
+		return fmt.Sprintf("%d new records", records)
+	}
+	return ""
+}
@@ -0,0 +1,43 @@
+package scrapers
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestCron_Next(t *testing.T) {
+	from := time.Date(2022, time.August, 20, 12, 34, 56, 0, time.UTC) // a saturday
+
+	tests := []struct {
+		expr string
+		next time.Time
+	}{
+		{expr: "* * * * *", next: time.Date(2022, time.August, 20, 12, 35, 0, 0, time.UTC)},
+		{expr: "*/15 * * * *", next: time.Date(2022, time.August, 20, 12, 45, 0, 0, time.UTC)},
+		{expr: "30 3 * * *", next: time.Date(2022, time.August, 21, 3, 30, 0, 0, time.UTC)},
+		{expr: "0 9 * * 1-5", next: time.Date(2022, time.August, 22, 9, 0, 0, 0, time.UTC)},
+		{expr: "0 0 1,15 * *", next: time.Date(2022, time.September, 1, 0, 0, 0, 0, time.UTC)},
+		{expr: "0 0 13 * 5", next: time.Date(2022, time.August, 26, 0, 0, 0, 0, time.UTC)},
+		{expr: "0 0 */2 * 1", next: time.Date(2022, time.August, 29, 0, 0, 0, 0, time.UTC)},
+		{expr: "0 0 * * 7", next: time.Date(2022, time.August, 21, 0, 0, 0, 0, time.UTC)},
+		{expr: "@monthly", next: time.Date(2022, time.September, 1, 0, 0, 0, 0, time.UTC)},
+		{expr: "0 0 30 2 *", next: time.Time{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			cron, err := ParseCron(tt.expr)
+			require.NoError(t, err)
+			assert.Equal(t, tt.next, cron.Next(from))
+		})
+	}
+}
+
+func TestCron_ParseErrors(t *testing.T) {
+	for _, expr := range []string{"", "* * * *", "60 * * * *", "* * 0 * *", "*/0 * * * *", "5-1 * * * *", "a * * * *"} {
+		_, err := ParseCron(expr)
+		assert.Error(t, err, expr)
+	}
+}
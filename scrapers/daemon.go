@@ -0,0 +1,63 @@
+package scrapers
+
+import (
+	"context"
+	"errors"
+	"hello/scraper/models"
+	"log"
+	"time"
+)
+
+// Crawler runs a single crawl.
+type Crawler interface {
+	Start(ctx context.Context) (*models.CrawlResult, error)
+}
+
+// Daemon runs a crawl cycle whenever its schedule says so, until it is
+// stopped. Every cycle is a crawl of its own with its own run record.
+type Daemon struct {
+	crawler  Crawler
+	schedule Schedule
+	now      func() time.Time
+}
+
+func NewDaemon(crawler Crawler, schedule Schedule) *Daemon {
+	return &Daemon{
+		crawler:  crawler,
+		schedule: schedule,
+		now:      time.Now,
+	}
+}
+
+// Run starts with a cycle right away, so a restarted daemon catches up on
+// what it missed, and then sleeps until the next start the schedule gives.
+// A cycle that fails is logged and the next one runs as planned. Run
+// returns once ctx is done, after the cycle in progress wound down.
+func (d *Daemon) Run(ctx context.Context) error {
+	for cycle := 1; ; cycle++ {
+		started := d.now()
+		log.Printf("Starting cycle %d", cycle)
+		_, err := d.crawler.Start(ctx)
+		if ctx.Err() != nil {
+			return nil
+		}
+		if err != nil {
+			log.Printf("Cycle %d failed: %v", cycle, err)
+		}
+
+		next := d.schedule.Next(started)
+		if now := d.now(); next.Before(now) {
+			// the cycle overran its slot, skip to the next one
+			next = d.schedule.Next(now)
+		}
+		if next.IsZero() {
+			return errors.New("schedule has no next start")
+		}
+		log.Printf("Cycle %d done, next one starts at %v", cycle, next.Format(time.RFC3339))
+
+		err = sleep(ctx, next.Sub(d.now()))
+		if err != nil {
+			return nil
+		}
+	}
+}
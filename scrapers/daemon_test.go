@@ -0,0 +1,50 @@
+package scrapers
+
+import (
+	"context"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"hello/scraper/models"
+	"testing"
+	"time"
+)
+
+type cycleCrawler struct {
+	cycles int
+	stopAt int
+	cancel context.CancelFunc
+}
+
+func (c *cycleCrawler) Start(ctx context.Context) (*models.CrawlResult, error) {
+	c.cycles++
+	if c.cycles == c.stopAt {
+		c.cancel()
+		<-ctx.Done()
+		return &models.CrawlResult{ExitReason: models.ExitInterrupted}, nil
+	}
+	if c.cycles == 1 {
+		return nil, errors.New("database is locked")
+	}
+	return &models.CrawlResult{ExitReason: models.ExitCompleted}, nil
+}
+
+func TestDaemon_Run(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	crawler := &cycleCrawler{stopAt: 3, cancel: cancel}
+
+	err := NewDaemon(crawler, Interval(10*time.Millisecond)).Run(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 3, crawler.cycles)
+}
+
+func TestDaemon_RunStopsWhileSleeping(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	crawler := &cycleCrawler{}
+
+	err := NewDaemon(crawler, Interval(time.Hour)).Run(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 1, crawler.cycles)
+}
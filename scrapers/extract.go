@@ -0,0 +1,403 @@
+package scrapers
+
+import (
+	"fmt"
+	"golang.org/x/net/html"
+	"hello/scraper/models"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// column is a field of models.TableInfo a table column is read into.
+type column int
+
+const (
+	columnNode column = iota
+	columnName
+	columnSubCh
+	columnSubTotal
+	columnDesc
+	columnInf
+)
+
+// headers maps the normalized <th> text of the oid tables to their column.
+var headers = map[string]column{
+	"node":            columnNode,
+	"oid":             columnNode,
+	"name":            columnName,
+	"sub children":    columnSubCh,
+	"sub nodes total": columnSubTotal,
+	"description":     columnDesc,
+	"information":     columnInf,
+}
+
+// MalformedRowsError lists the table rows that had to be skipped. The
+// records of the other rows are still good.
+type MalformedRowsError struct {
+	Rows []string
+}
+
+func (e *MalformedRowsError) Error() string {
+	return fmt.Sprintf("%d malformed rows: %v", len(e.Rows), strings.Join(e.Rows, "; "))
+}
+
+// extraction is what a page says: the records of its oid tables, the oids
+// of its Brothers section and the details of the oid of the page, nil when
+// it lists none. Details that could not be read are listed in invalid; they
+// say nothing about the rows of the page.
+type extraction struct {
+	records  map[string]*models.TableInfo
+	siblings []string
+	details  *models.OidDetails
+	invalid  []string
+}
+
+// extractor collects the records of the oid tables of a page. Tables are
+// read by their header row, so columns may come in any order and columns
+// it does not know are ignored. Tables without a Node or OID column are
+// skipped. Only the oids of the tables in the Brothers section are kept, as
+// siblings, since their records are the parent page's to tell. Definition
+// lists are read into the details of the page's oid.
+type extractor struct {
+	extraction
+	malformed []string
+	tables    int
+	brothers  bool
+}
+
+func extract(doc *html.Node) (*extraction, error) {
+	e := &extractor{extraction: extraction{records: make(map[string]*models.TableInfo, 10)}}
+	e.walk(doc)
+
+	if len(e.malformed) > 0 {
+		return &e.extraction, &MalformedRowsError{Rows: e.malformed}
+	}
+	return &e.extraction, nil
+}
+
+func (e *extractor) walk(n *html.Node) {
+	if n.Type == html.ElementNode {
+		switch n.Data {
+		case "h3":
+			e.brothers = strings.Contains(textOf(n), "Brothers")
+			return
+		case "table":
+			e.tables++
+			e.table(n)
+			return
+		case "dl":
+			if !e.brothers {
+				e.definitions(n)
+			}
+			return
+		}
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		e.walk(c)
+	}
+}
+
+func (e *extractor) table(table *html.Node) {
+	var columns []column
+	known := make([]bool, 0)
+	for i, row := range rowsOf(table) {
+		cells := cellsOf(row)
+		if columns == nil {
+			if !isHeader(cells) {
+				continue
+			}
+			for _, cell := range cells {
+				col, ok := headers[normalizeHeader(textOf(cell))]
+				columns = append(columns, col)
+				known = append(known, ok)
+			}
+			if !hasNode(columns, known) {
+				return
+			}
+			continue
+		}
+
+		oid, info, err := readRow(cells, columns, known)
+		if err != nil {
+			e.malformed = append(e.malformed, fmt.Sprintf("table %d row %d: %v", e.tables, i+1, err))
+			continue
+		}
+		if e.brothers {
+			e.siblings = append(e.siblings, oid)
+		} else {
+			e.records[oid] = info
+		}
+	}
+}
+
+// definitions reads the dt/dd pairs of a definition list into the details.
+func (e *extractor) definitions(dl *html.Node) {
+	var term string
+	for c := dl.FirstChild; c != nil; c = c.NextSibling {
+		if c.Type != html.ElementNode {
+			continue
+		}
+		switch c.Data {
+		case "dt":
+			term = normalizeHeader(textOf(c))
+		case "dd":
+			if term == "" {
+				continue
+			}
+			err := e.detail(term, textOf(c))
+			if err != nil {
+				e.invalid = append(e.invalid, fmt.Sprintf("detail %q: %v", term, err))
+			}
+			term = ""
+		}
+	}
+}
+
+func (e *extractor) detail(term, value string) error {
+	if value == "" {
+		return nil
+	}
+	details := e.details
+	if details == nil {
+		details = &models.OidDetails{}
+	}
+
+	var err error
+	switch {
+	case strings.Contains(term, "asn.1"):
+		details.ASN1 = value
+	case strings.Contains(term, "iri"):
+		details.IRI = value
+	case strings.Contains(term, "dot notation"):
+		details.Dot = value
+	case strings.Contains(term, "authority"), strings.Contains(term, "registrant"):
+		details.Authority = value
+	case strings.Contains(term, "creation"), strings.Contains(term, "created"):
+		details.Created, err = parseDate(value)
+	case strings.Contains(term, "modification"), strings.Contains(term, "modified"):
+		details.Modified, err = parseDate(value)
+	default:
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	e.details = details
+	return nil
+}
+
+// dateLayouts are the ways dates are written on the pages, after
+// parseDate took the dots out.
+var dateLayouts = []string{
+	"2006-01-02",
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04",
+	time.RFC3339,
+	"Jan 2, 2006",
+	"January 2, 2006",
+	"Jan 2, 2006, 3:04 pm",
+	"January 2, 2006, 3:04 pm",
+	"Jan 2, 2006, 3 pm",
+	"January 2, 2006, 3 pm",
+	"2 January 2006",
+	"2 Jan 2006",
+}
+
+// djangoTimes spells out the times Django writes as words.
+var djangoTimes = strings.NewReplacer(", noon", ", 12 pm", ", midnight", ", 12 am")
+
+// parseDate reads a date as the site writes it, like "2022-08-20" or the
+// "Aug. 20, 2022", "Sept. 5, 2022, 3:04 p.m." and "March 3, 2010, noon"
+// Django writes.
+func parseDate(text string) (time.Time, error) {
+	text = strings.ReplaceAll(strings.ReplaceAll(text, ".", ""), "Sept ", "Sep ")
+	text = djangoTimes.Replace(text)
+	for _, layout := range dateLayouts {
+		date, err := time.Parse(layout, text)
+		if err == nil {
+			return date, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("%q is no date", text)
+}
+
+func readRow(cells []*html.Node, columns []column, known []bool) (string, *models.TableInfo, error) {
+	if len(cells) != len(columns) {
+		return "", nil, fmt.Errorf("%d cells for %d columns", len(cells), len(columns))
+	}
+
+	oid := ""
+	info := &models.TableInfo{}
+	for i, cell := range cells {
+		if !known[i] {
+			continue
+		}
+		text := textOf(cell)
+		var err error
+		switch columns[i] {
+		case columnNode:
+			oid, err = nodeOf(cell)
+		case columnName:
+			info.Name = text
+		case columnSubCh:
+			info.SubCh, err = count(text)
+		case columnSubTotal:
+			info.SubTotal, err = count(text)
+		case columnDesc:
+			info.Desc = markdownOf(cell)
+		case columnInf:
+			info.Inf = markdownOf(cell)
+		}
+		if err != nil {
+			return "", nil, err
+		}
+	}
+	if info.Name == "" {
+		return "", nil, fmt.Errorf("no name for %v", oid)
+	}
+
+	return oid, info, nil
+}
+
+// nodeOf reads the oid out of the link in a Node cell.
+func nodeOf(cell *html.Node) (string, error) {
+	link := findElement(cell, "a")
+	if link == nil {
+		return "", fmt.Errorf("no link in node cell %q", textOf(cell))
+	}
+	href, ok := attrOf(link, "href")
+	if !ok {
+		return "", fmt.Errorf("no href in node cell %q", textOf(cell))
+	}
+
+	oid := strings.TrimPrefix(strings.TrimSpace(href), baseUrl)
+	if !isOidPath(oid) || oid == "/" {
+		return "", fmt.Errorf("link %q is no oid", href)
+	}
+	return oid, nil
+}
+
+// isOidPath reports whether path is the url path of an oid page, like
+// "/1.3.6.1" or "/".
+func isOidPath(path string) bool {
+	if path == "/" {
+		return true
+	}
+	for _, arc := range strings.Split(strings.TrimPrefix(path, "/"), ".") {
+		if arc == "" || strings.Trim(arc, "0123456789") != "" {
+			return false
+		}
+	}
+	return true
+}
+
+func count(text string) (int, error) {
+	if text == "" {
+		return 0, nil
+	}
+	n, err := strconv.Atoi(strings.ReplaceAll(text, ",", ""))
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("%q is no count", text)
+	}
+	return n, nil
+}
+
+func isHeader(cells []*html.Node) bool {
+	if len(cells) == 0 {
+		return false
+	}
+	for _, cell := range cells {
+		if cell.Data != "th" {
+			return false
+		}
+	}
+	return true
+}
+
+func hasNode(columns []column, known []bool) bool {
+	for i, col := range columns {
+		if known[i] && col == columnNode {
+			return true
+		}
+	}
+	return false
+}
+
+func normalizeHeader(text string) string {
+	return strings.ToLower(strings.Join(strings.Fields(text), " "))
+}
+
+// rowsOf returns the rows of table, looking into its sections but not into
+// nested tables.
+func rowsOf(table *html.Node) []*html.Node {
+	var rows []*html.Node
+	for c := table.FirstChild; c != nil; c = c.NextSibling {
+		if c.Type != html.ElementNode {
+			continue
+		}
+		switch c.Data {
+		case "tr":
+			rows = append(rows, c)
+		case "thead", "tbody", "tfoot":
+			for r := c.FirstChild; r != nil; r = r.NextSibling {
+				if r.Type == html.ElementNode && r.Data == "tr" {
+					rows = append(rows, r)
+				}
+			}
+		}
+	}
+	return rows
+}
+
+func cellsOf(row *html.Node) []*html.Node {
+	var cells []*html.Node
+	for c := row.FirstChild; c != nil; c = c.NextSibling {
+		if c.Type == html.ElementNode && (c.Data == "td" || c.Data == "th") {
+			cells = append(cells, c)
+		}
+	}
+	return cells
+}
+
+// textOf returns the text content of n with whitespace collapsed.
+func textOf(n *html.Node) string {
+	var b strings.Builder
+	var f func(*html.Node)
+	f = func(n *html.Node) {
+		switch {
+		case n.Type == html.TextNode:
+			b.WriteString(n.Data)
+		case n.Type == html.ElementNode && n.Data == "br":
+			b.WriteString(" ")
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			f(c)
+		}
+	}
+	f(n)
+
+	return strings.Join(strings.Fields(b.String()), " ")
+}
+
+func findElement(n *html.Node, tag string) *html.Node {
+	if n.Type == html.ElementNode && n.Data == tag {
+		return n
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if found := findElement(c, tag); found != nil {
+			return found
+		}
+	}
+	return nil
+}
+
+func attrOf(n *html.Node, key string) (string, bool) {
+	for _, attr := range n.Attr {
+		if attr.Key == key {
+			return attr.Val, true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,142 @@
+package scrapers
+
+import (
+	"golang.org/x/net/html"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+var (
+	markdownEscaper = strings.NewReplacer(`\`, `\\`, "`", "\\`", "*", `\*`, "_", `\_`, "[", `\[`, "]", `\]`,
+		"&", "&amp;", "<", "&lt;", ">", "&gt;")
+	spaces     = regexp.MustCompile(`[ \t\r\n\f]+`)
+	blankLines = regexp.MustCompile(`\n{3,}`)
+	// blockStart matches text at the start of a line that Markdown would
+	// take for a heading or a list item
+	blockStart = regexp.MustCompile(`^(#|-|\+|\d+[.)])`)
+)
+
+// listItem marks the list items writeMarkdown starts, so they are told apart
+// from text that merely starts with a dash. HTML text never holds NUL.
+const listItem = "\x00- "
+
+// markdownOf turns the content of a table cell into Markdown. Only line
+// breaks, paragraphs, lists, emphasis, code and http links are kept; other
+// markup is dropped for its text, scripts and styles altogether. Relative
+// links are made absolute. Text is escaped so it never turns into markup,
+// HTML included.
+func markdownOf(n *html.Node) string {
+	lines := strings.Split(renderMarkdown(n), "\n")
+	for i, line := range lines {
+		item := strings.HasPrefix(line, listItem)
+		line = blockStart.ReplaceAllStringFunc(strings.TrimPrefix(line, listItem), escapeBlockStart)
+		if item {
+			line = "- " + line
+		}
+		lines[i] = line
+	}
+	// list items nested in links or emphasis are no list items anymore
+	return strings.ReplaceAll(strings.Join(lines, "\n"), "\x00", "")
+}
+
+// renderMarkdown is markdownOf without the escaping of line starts, for the
+// parts of a cell.
+func renderMarkdown(n *html.Node) string {
+	var b strings.Builder
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		writeMarkdown(&b, c)
+	}
+
+	lines := strings.Split(b.String(), "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimSpace(spaces.ReplaceAllString(line, " "))
+		if rest := strings.TrimPrefix(lines[i], listItem); rest != lines[i] {
+			lines[i] = listItem + strings.TrimSpace(rest)
+		}
+	}
+	return strings.TrimSpace(blankLines.ReplaceAllString(strings.Join(lines, "\n"), "\n\n"))
+}
+
+// escapeBlockStart escapes the last character of a block start, like "1\.".
+func escapeBlockStart(start string) string {
+	return start[:len(start)-1] + `\` + start[len(start)-1:]
+}
+
+func writeMarkdown(b *strings.Builder, n *html.Node) {
+	switch n.Type {
+	case html.TextNode:
+		b.WriteString(markdownEscaper.Replace(spaces.ReplaceAllString(n.Data, " ")))
+		return
+	case html.ElementNode:
+	default:
+		return
+	}
+
+	switch n.Data {
+	case "script", "style", "noscript", "iframe", "object", "template":
+	case "br":
+		b.WriteString("\n")
+	case "p", "div", "ul", "ol", "table", "blockquote", "pre":
+		b.WriteString("\n\n")
+		writeChildren(b, n)
+		b.WriteString("\n\n")
+	case "li", "tr":
+		b.WriteString("\n" + listItem)
+		writeChildren(b, n)
+	case "code", "tt", "kbd", "samp":
+		code := textOf(n)
+		if code == "" {
+			return
+		}
+		if strings.Contains(code, "`") {
+			b.WriteString("`` " + code + " ``")
+		} else {
+			b.WriteString("`" + code + "`")
+		}
+	case "strong", "b":
+		wrapMarkdown(b, n, "**")
+	case "em", "i":
+		wrapMarkdown(b, n, "*")
+	case "a":
+		href, _ := attrOf(n, "href")
+		target, ok := linkTarget(href)
+		text := renderMarkdown(n)
+		if !ok || text == "" {
+			b.WriteString(text)
+			return
+		}
+		b.WriteString("[" + text + "](" + target + ")")
+	default:
+		writeChildren(b, n)
+	}
+}
+
+func writeChildren(b *strings.Builder, n *html.Node) {
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		writeMarkdown(b, c)
+	}
+}
+
+func wrapMarkdown(b *strings.Builder, n *html.Node, mark string) {
+	text := renderMarkdown(n)
+	if text == "" {
+		return
+	}
+	b.WriteString(mark + text + mark)
+}
+
+// linkTarget resolves href against the site, keeping only http links.
+func linkTarget(href string) (string, bool) {
+	base, _ := url.Parse(baseUrl + "/")
+	ref, err := url.Parse(strings.TrimSpace(href))
+	if err != nil || href == "" {
+		return "", false
+	}
+	target := base.ResolveReference(ref)
+	if target.Scheme != "http" && target.Scheme != "https" {
+		return "", false
+	}
+
+	return strings.NewReplacer("(", "%28", ")", "%29", " ", "%20").Replace(target.String()), true
+}
@@ -0,0 +1,84 @@
+package scrapers
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/html"
+	"strings"
+	"testing"
+)
+
+func TestMarkdownOf(t *testing.T) {
+	tests := []struct {
+		name     string
+		cell     string
+		expected string
+	}{
+		{
+			name:     "text",
+			cell:     "  International\n   Organization  ",
+			expected: "International Organization",
+		},
+		{
+			name:     "line breaks",
+			cell:     "first<br>\nsecond<br>\n<br>\n<br><br>third",
+			expected: "first\nsecond\n\nthird",
+		},
+		{
+			name:     "emphasis and code",
+			cell:     "<strong><code>itu-r</code></strong> is <em>only</em> for <code>{itu-r(0) <a href=\"/0.5\">r(5)</a>}</code>",
+			expected: "**`itu-r`** is *only* for `{itu-r(0) r(5)}`",
+		},
+		{
+			name:     "links",
+			cell:     `see <a href="/1.3">org</a>, <a href="http://itu.int/rec/X.660">X.660 (2011)</a> and <a href="javascript:alert(1)">this</a>`,
+			expected: "see [org](" + baseUrl + "/1.3), [X.660 (2011)](http://itu.int/rec/X.660) and this",
+		},
+		{
+			name:     "escaping",
+			cell:     "id_ce * [1]",
+			expected: `id\_ce \* \[1\]`,
+		},
+		{
+			name:     "html in text",
+			cell:     "see &lt;img src=x onerror=alert(1)&gt; &amp; more",
+			expected: "see &lt;img src=x onerror=alert(1)&gt; &amp; more",
+		},
+		{
+			name:     "block starts",
+			cell:     "# not a heading<br>- no item<br>1. no item either<br>+ 2) none<br>a - b",
+			expected: "\\# not a heading\n\\- no item\n1\\. no item either\n\\+ 2) none\na - b",
+		},
+		{
+			name:     "block starts in lists",
+			cell:     "<ul><li>- dash</li><li>2. two</li></ul>",
+			expected: "- \\- dash\n- 2\\. two",
+		},
+		{
+			name:     "unsafe markup",
+			cell:     `<script>alert(1)</script><style>p {}</style><span onclick="x()">safe</span><img src="x.png">`,
+			expected: "safe",
+		},
+		{
+			name:     "lists",
+			cell:     "arcs:<ul><li>zero</li><li>one</li></ul>done",
+			expected: "arcs:\n\n- zero\n- one\n\ndone",
+		},
+		{
+			name:     "empty",
+			cell:     "<b></b> ",
+			expected: "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc, err := html.Parse(strings.NewReader("<table><tr><td>" + tt.cell + "</td></tr></table>"))
+			require.NoError(t, err)
+			cell := findElement(doc, "td")
+			require.NotNil(t, cell)
+
+			assert.Equal(t, tt.expected, markdownOf(cell))
+		})
+	}
+}
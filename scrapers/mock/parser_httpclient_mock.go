@@ -5,6 +5,7 @@
 package scrapers
 
 import (
+	context "context"
 	http "net/http"
 	reflect "reflect"
 
@@ -48,3 +49,41 @@ func (mr *MockHTTPClientMockRecorder) Do(req interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Do", reflect.TypeOf((*MockHTTPClient)(nil).Do), req)
 }
+
+// MockRobotsChecker is a mock of RobotsChecker interface.
+type MockRobotsChecker struct {
+	ctrl     *gomock.Controller
+	recorder *MockRobotsCheckerMockRecorder
+}
+
+// MockRobotsCheckerMockRecorder is the mock recorder for MockRobotsChecker.
+type MockRobotsCheckerMockRecorder struct {
+	mock *MockRobotsChecker
+}
+
+// NewMockRobotsChecker creates a new mock instance.
+func NewMockRobotsChecker(ctrl *gomock.Controller) *MockRobotsChecker {
+	mock := &MockRobotsChecker{ctrl: ctrl}
+	mock.recorder = &MockRobotsCheckerMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockRobotsChecker) EXPECT() *MockRobotsCheckerMockRecorder {
+	return m.recorder
+}
+
+// Allowed mocks base method.
+func (m *MockRobotsChecker) Allowed(ctx context.Context, url string) (bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Allowed", ctx, url)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Allowed indicates an expected call of Allowed.
+func (mr *MockRobotsCheckerMockRecorder) Allowed(ctx, url interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Allowed", reflect.TypeOf((*MockRobotsChecker)(nil).Allowed), ctx, url)
+}
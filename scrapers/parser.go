@@ -2,142 +2,214 @@ package scrapers
 
 import (
 	"bytes"
+	"context"
+	"errors"
 	"fmt"
 	"golang.org/x/net/html"
 	"hello/scraper/models"
 	"io"
 	"log"
-	"math/rand"
 	"net/http"
-	"strconv"
 	"strings"
-	"sync"
 	"time"
 )
 
-var (
-	userAgent = []string{
-		"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/58.0.3029.110 Safari/537.36",
-		"Mozilla/5.0 (Windows NT 10.0; Win64; x64; rv:53.0) Gecko/20100101 Firefox/53.0",
-		"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/51.0.2704.79 Safari/537.36 Edge/14.14393",
-		"Mozilla/5.0 (Linux; Android 6.0.1; SAMSUNG SM-G570Y Build/MMB29K) AppleWebKit/537.36 (KHTML, like Gecko) SamsungBrowser/4.0 Chrome/44.0.2403.133 Mobile Safari/537.36",
-		"Mozilla/5.0 (compatible; Googlebot/2.1; +http://www.google.com/bot.html)",
-	}
-)
-
 type HTTPClient interface {
 	Do(req *http.Request) (*http.Response, error)
 }
 
+type RobotsChecker interface {
+	Allowed(ctx context.Context, url string) (bool, error)
+}
+
 type OidParser struct {
-	urlCache   *sync.Map
 	httpClient HTTPClient
+	userAgent  string
+	robots     RobotsChecker
+	retry      RetryPolicy
+}
+
+// fetchResult is a fetched page along with the validators to fetch it again
+// conditionally. notModified is set when the server answered 304.
+type fetchResult struct {
+	body         []byte
+	etag         string
+	lastModified string
+	notModified  bool
 }
 
-func NewOIDParser(urlCache *sync.Map, httpClient HTTPClient) *OidParser {
+// NewOIDParser creates a parser sending userAgent with every request, the
+// agent robots checks the rules for. robots may be nil to skip robots.txt
+// checks.
+func NewOIDParser(httpClient HTTPClient, userAgent string, robots RobotsChecker, retry RetryPolicy) *OidParser {
 	return &OidParser{
-		urlCache:   urlCache,
 		httpClient: httpClient,
+		userAgent:  userAgent,
+		robots:     robots,
+		retry:      retry,
 	}
 }
 
-func (p *OidParser) Parse(urls chan string, paths chan<- string, pathsToCache chan<- string) error {
-	for url := range urls {
-		body, err := p.getBody(baseUrl + url)
-		if err != nil {
-			log.Printf("Couldn`t get body of url %v: %v; Starting retries", url, err.Error())
-			body, err = p.startRetries(err, url)
+// Parse fetches the pages of the items it is handed until ctx is done or it
+// receives a nil item.
+func (p *OidParser) Parse(ctx context.Context, items <-chan *models.FrontierItem, pages chan<- *models.Page) error {
+	for {
+		var item *models.FrontierItem
+		select {
+		case <-ctx.Done():
+			return nil
+		case item = <-items:
+		}
+		if item == nil {
+			return nil
+		}
+		url := item.Oid
+		started := time.Now()
+
+		if p.robots != nil {
+			allowed, err := p.allowed(ctx, url)
+			if err == nil && !allowed {
+				err = ErrDisallowed
+			}
 			if err != nil {
-				urls <- url
+				pages <- &models.Page{Oid: url, Err: err}
 				continue
 			}
 		}
 
-		data, err := p.filter(body)
-		if err != nil {
+		result, retries, err := p.fetch(ctx, item)
+		if errors.Is(err, ErrNoRecording) {
+			pages <- &models.Page{Oid: url, Err: err}
 			return err
 		}
+		if err != nil {
+			pages <- &models.Page{Oid: url, Err: err, Retries: retries, Elapsed: time.Since(started)}
+			continue
+		}
+		if result.notModified {
+			pages <- &models.Page{Oid: url, Unchanged: true, ETag: result.etag, LastModified: result.lastModified,
+				Elapsed: time.Since(started)}
+			continue
+		}
 
-		for link := range data {
-			pathsToCache <- link
+		page, err := p.parsePage(url, result.body)
+		if err != nil {
+			return err
 		}
+		page.ETag = result.etag
+		page.LastModified = result.lastModified
+		page.Elapsed = time.Since(started)
+		pages <- page
+	}
+}
 
-		for link, tableInfo := range data {
-			if _, ok := p.urlCache.Load(link); ok {
-				continue
-			}
-			p.urlCache.Store(link, tableInfo)
-			paths <- link
+// parsePage reads the records, links, siblings and details out of body, the
+// page of oid.
+func (p *OidParser) parsePage(oid string, body []byte) (*models.Page, error) {
+	found, err := p.filter(body)
+	var malformed *MalformedRowsError
+	if errors.As(err, &malformed) {
+		log.Printf("Couldn`t read all records of %v: %v", oid, err)
+	} else if err != nil {
+		return nil, err
+	}
+	if len(found.invalid) > 0 {
+		log.Printf("Couldn`t read all details of %v: %v", oid, strings.Join(found.invalid, "; "))
+	}
+
+	page := &models.Page{Oid: oid, Records: found.records, Details: found.details, URL: baseUrl + oid, Body: body}
+	for link := range found.records {
+		page.Links = append(page.Links, link)
+		// a page with malformed rows may not list all its children, so none
+		// of them get tombstoned for missing from it
+		if models.Parent(link) == oid && malformed == nil {
+			page.Children = append(page.Children, link)
+		}
+	}
+	for _, sibling := range found.siblings {
+		if sibling != oid && models.Parent(sibling) == models.Parent(oid) {
+			page.Siblings = append(page.Siblings, sibling)
 		}
 	}
-	return nil
+
+	return page, nil
 }
 
-func (p *OidParser) filter(text []byte) (map[string]*models.TableInfo, error) {
-	mibData := make(map[string]*models.TableInfo, 10)
-	tableData := make([]string, 5)
-	isBrothers := false
+// filter reads the records out of the oid tables of a page, the oids out of
+// its Brothers section and the details out of its definition lists.
+// Malformed rows are reported in a *MalformedRowsError next to what the
+// others said, details that could not be read in the invalid list of the
+// extraction.
+func (p *OidParser) filter(text []byte) (*extraction, error) {
 	doc, err := html.Parse(bytes.NewReader(text))
 	if err != nil {
 		return nil, fmt.Errorf("can`t parse text: %v", err)
 	}
 
-	var f func(*html.Node)
-	f = func(n *html.Node) {
-		if n.Type == html.ElementNode && n.Data == "h3" {
-			if strings.Contains(n.FirstChild.Data, "Brothers") {
-				isBrothers = true
-			}
-		}
-		if n.Type == html.ElementNode && n.Data == "tr" && !isBrothers {
-			if n.FirstChild.FirstChild != nil {
-				if n.FirstChild.FirstChild.Data != "Node" && n.FirstChild.FirstChild.Data != "OID" {
-					child := n.FirstChild.NextSibling
-					for child != nil && len(tableData) < 5 {
-						tableData = append(tableData, child.FirstChild.Data)
-						child = child.NextSibling
-					}
-				}
-			} else {
-				if n.FirstChild.NextSibling.FirstChild.FirstChild.Data != "OID" && !isBrothers {
-					child := n.FirstChild.NextSibling.NextSibling.NextSibling
-					for child != nil && len(tableData) < 5 {
-						if child.FirstChild != nil {
-							tableData = append(tableData, child.FirstChild.Data) // 2 ee
-							child = child.NextSibling.NextSibling
-						} else {
-							break
-						}
-					}
-				}
-			}
+	return extract(doc)
+}
+
+// allowed asks robots whether url may be fetched, retrying as long as the
+// retry policy allows when its robots.txt could not be fetched.
+func (p *OidParser) allowed(ctx context.Context, url string) (bool, error) {
+	for attempt := 0; ; attempt++ {
+		allowed, err := p.robots.Allowed(ctx, baseUrl+url)
+		if err == nil {
+			return allowed, nil
 		}
-		if n.Type == html.ElementNode && n.Data == "a" && !isBrothers {
-			attrValue := n.Attr[0].Val
-			if n.Attr[0].Key == "href" &&
-				(len(attrValue) < 3 || strings.Contains(attrValue, ".")) &&
-				!strings.Contains(attrValue, "http") &&
-				!strings.Contains(attrValue, "mib") {
-				mibData[attrValue] = mapToTableInfo(tableData)
-				tableData = tableData[:0]
-			}
+
+		delay, ok := p.retry.Next(attempt, err)
+		if !ok {
+			return false, err
 		}
-		for c := n.FirstChild; c != nil; c = c.NextSibling {
-			f(c)
+		log.Printf("Couldn`t check robots.txt for url %v: %v; Retrying in %v", url, err, delay.Round(time.Millisecond))
+		err = sleep(ctx, delay)
+		if err != nil {
+			return false, err
 		}
 	}
-	f(doc)
+}
 
-	return mibData, nil
+// fetch gets the page of item, retrying as long as the retry policy and
+// the attempts item has left allow. It returns how often it retried.
+func (p *OidParser) fetch(ctx context.Context, item *models.FrontierItem) (*fetchResult, int, error) {
+	url := item.Oid
+	for attempt := 0; ; attempt++ {
+		result, err := p.getBody(ctx, baseUrl+url, item)
+		if err == nil {
+			return result, attempt, nil
+		}
+
+		if p.retry.MaxAttempts > 0 && item.Attempts+attempt >= p.retry.MaxAttempts {
+			return nil, attempt, err
+		}
+		delay, ok := p.retry.Next(attempt, err)
+		if !ok {
+			return nil, attempt, err
+		}
+		log.Printf("Couldn`t get body of url %v: %v; Retrying in %v", url, err, delay.Round(time.Millisecond))
+		err = sleep(ctx, delay)
+		if err != nil {
+			return nil, attempt, err
+		}
+	}
 }
 
-func (p *OidParser) getBody(url string) ([]byte, error) {
-	req, err := http.NewRequest("GET", url, nil)
+// getBody fetches url. When cached carries validators from an earlier fetch
+// the request is made conditional on them.
+func (p *OidParser) getBody(ctx context.Context, url string, cached *models.FrontierItem) (*fetchResult, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
 	if err != nil {
 		return nil, err
 	}
 
-	req.Header.Set("User-Agent", userAgent[rand.Intn(5)])
+	req.Header.Set("User-Agent", p.userAgent)
+	if cached != nil && cached.ETag != "" {
+		req.Header.Set("If-None-Match", cached.ETag)
+	}
+	if cached != nil && cached.LastModified != "" {
+		req.Header.Set("If-Modified-Since", cached.LastModified)
+	}
 	response, err := p.httpClient.Do(req)
 	if err != nil {
 		return nil, err
@@ -149,71 +221,29 @@ func (p *OidParser) getBody(url string) ([]byte, error) {
 			log.Fatal("can`t close body: ", err)
 		}
 	}(response.Body)
-	body, err := io.ReadAll(response.Body)
-	if err != nil {
-		return nil, err
+	result := &fetchResult{
+		etag:         response.Header.Get("ETag"),
+		lastModified: response.Header.Get("Last-Modified"),
 	}
-
-	return body, nil
-}
-
-func (p *OidParser) startRetries(err error, url string) ([]byte, error) {
-	var body []byte
-	retries := 10
-
-	for err != nil || retries == 0 {
-		body, err = p.getBody(baseUrl + url)
-		retries--
+	if response.StatusCode == http.StatusNotModified {
+		// a 304 may leave out validators that did not change
+		if result.etag == "" && cached != nil {
+			result.etag = cached.ETag
+		}
+		if result.lastModified == "" && cached != nil {
+			result.lastModified = cached.LastModified
+		}
+		result.notModified = true
+		return result, nil
+	}
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		return nil, newFetchError(response)
 	}
+
+	result.body, err = io.ReadAll(response.Body)
 	if err != nil {
-		log.Printf("Couldn`t get body of url %v after 10 retries: %v; Timeout for 1 minute", url, err.Error())
-		time.Sleep(time.Minute)
 		return nil, err
 	}
 
-	return body, nil
-}
-
-func mapToTableInfo(data []string) *models.TableInfo {
-	switch len(data) {
-	case 0:
-		return &models.TableInfo{}
-	case 1:
-		return &models.TableInfo{
-			Name: data[0],
-		}
-	case 2:
-		subCh, _ := strconv.Atoi(data[1])
-		return &models.TableInfo{
-			Name:  data[0],
-			SubCh: subCh,
-		}
-	case 3:
-		subCh, _ := strconv.Atoi(data[1])
-		totalCh, _ := strconv.Atoi(data[2])
-		return &models.TableInfo{
-			Name:     data[0],
-			SubCh:    subCh,
-			SubTotal: totalCh,
-		}
-	case 4:
-		subCh, _ := strconv.Atoi(data[1])
-		totalCh, _ := strconv.Atoi(data[2])
-		return &models.TableInfo{
-			Name:     data[0],
-			SubCh:    subCh,
-			SubTotal: totalCh,
-			Desc:     data[3],
-		}
-	default:
-		subCh, _ := strconv.Atoi(data[1])
-		totalCh, _ := strconv.Atoi(data[2])
-		return &models.TableInfo{
-			Name:     data[0],
-			SubCh:    subCh,
-			SubTotal: totalCh,
-			Desc:     data[3],
-			Inf:      data[4],
-		}
-	}
+	return result, nil
 }
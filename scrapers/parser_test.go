@@ -1,67 +1,76 @@
 package scrapers
 
 import (
+	"context"
 	"errors"
 	"github.com/golang/mock/gomock"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"hello/scraper/models"
 	scrapers "hello/scraper/scrapers/mock"
 	"io"
 	"net/http"
 	"strings"
-	"sync"
 	"testing"
+	"time"
 )
 
 //go:generate mockgen -source=parser.go -destination=./mock/parser_httpclient_mock.go -package=scrapers
 
 func TestParser_NewOIDParser(t *testing.T) {
 	parserExpected := &OidParser{
-		urlCache:   nil,
 		httpClient: http.DefaultClient,
+		userAgent:  "oidscraper",
+		robots:     nil,
+		retry:      RetryPolicy{MaxRetries: 1},
 	}
-	parserActual := NewOIDParser(nil, http.DefaultClient)
+	parserActual := NewOIDParser(http.DefaultClient, "oidscraper", nil, RetryPolicy{MaxRetries: 1})
 
 	assert.Equal(t, parserExpected, parserActual)
 }
 
 func TestParser_filter(t *testing.T) {
-	parser := NewOIDParser(&sync.Map{}, http.DefaultClient)
+	parser := NewOIDParser(http.DefaultClient, "oidscraper", nil, RetryPolicy{})
 	tests := []struct {
 		name         string
 		body         string
 		expectedData map[string]*models.TableInfo
+		siblings     []string
+		malformed    int
 	}{
 		{
 			name: "success",
 			body: "<!DOCTYPE html>\n<html lang=\"en\">\n<head>\n    <meta charset=\"UTF-8\">\n    <title> Global OID reference database </title>\n    <meta name=\"description\" content=\"\">\n\n    <script src=\"/cdn-cgi/apps/head/2VsPAxpuBO-CkkZXqaeHnqT5qxU.js\"></script><script>\n      (function(i,s,o,g,r,a,m){i['GoogleAnalyticsObject']=r;i[r]=i[r]||function(){\n      (i[r].q=i[r].q||[]).push(arguments)},i[r].l=1*new Date();a=s.createElement(o),\n      m=s.getElementsByTagName(o)[0];a.async=1;a.src=g;m.parentNode.insertBefore(a,m)\n      })(window,document,'script','https://www.google-analytics.com/analytics.js','ga');\n\n      ga('create', 'UA-82642346-1', 'auto');\n      ga('send', 'pageview');\n    </script>\n\n    \n    <meta name=\"google-site-verification\" content=\"goC5jUiwFWTihZyBplddmH71LTkzQSVB89OWNoZKbEU\" />\n    <meta name=\"yandex-verification\" content=\"0c17a632986db6ed\" />\n\n\n    <style>\n        \n        \n        table {\n            border: solid brown 1px;\n            border-collapse: collapse;\n            margin-top: 15px\n        }\n        table td {\n            border: solid brown 1px;\n            padding: 2px 3px;\n        }\n        table th {\n            border: solid brown 1px;\n            padding: 5px 5px;\n            color: white;\n            background-color: hsla(34,85%,45%,1);\n            font-weight: normal;\n        }\n        h1 {\n            text-align: left;\n            display: block;\n            width: 100%;\n        }\n        h3 {\n            text-align: left;\n            display: block;\n            width: 100%;\n            background-color: #58bdff;\n            padding: 5px 0 5px 15px;\n            margin: 15px 0 0 0;\n        }\n        p {\n            padding: 5px 0 5px 15px;\n            margin: 0;\n            border-left: solid 2px #58bdff;\n        }\n        dl {\n          width: 100%;\n          overflow: hidden;\n          //background: #ff0;\n          padding: 0;\n          margin-top: 15px;\n        }\n        dt {\n          //float: left;\n          width: 20%;\n          background: #ff9400;\n          border-left: solid 2px #9b5700;\n          font-weight: bolder;\n          text-align: center;\n          padding: 5px 10px 5px 0;\n          margin-top: 15px;\n        }\n        dd {\n          //float: left;\n          width: 75%;\n          //background: #dd0;\n          border-left: solid 2px #9b5700;\n          padding: 5px 0 0 20px;\n          margin: 0;\n        }\n        .breadcrumb {\n            list-style: none;\n            overflow: hidden;\n            font: 16px Helvetica, Arial, Sans-Serif;\n            margin: 0;\n            padding: 0;\n        }\n        .breadcrumb li {\n            float: left;\n        }\n        .breadcrumb li a {\n            color: white;\n            text-decoration: none;\n            padding: 5px 0 5px 45px;\n            background: brown;                   /* fallback color */\n            background: hsla(34,85%,35%,1);\n            position: relative;\n            display: block;\n            float: left;\n        }\n\n        .breadcrumb li a:after {\n            content: \" \";\n            display: block;\n            width: 0;\n            height: 0;\n            border-top: 50px solid transparent;           /* Go big on the size, and let overflow hide */\n            border-bottom: 50px solid transparent;\n            border-left: 30px solid hsla(34,85%,35%,1);\n            position: absolute;\n            top: 50%;\n            margin-top: -50px;\n            left: 100%;\n            z-index: 2;\n        }\n\n        .breadcrumb li a:before {\n            content: \" \";\n            display: block;\n            width: 0;\n            height: 0;\n            border-top: 50px solid transparent;\n            border-bottom: 50px solid transparent;\n            border-left: 30px solid white;\n            position: absolute;\n            top: 50%;\n            margin-top: -50px;\n            margin-left: 1px;\n            left: 100%;\n            z-index: 1;\n        }\n\n        .breadcrumb li:first-child a {\n            padding-left: 10px;\n        }\n        .breadcrumb li:nth-child(2) a       { background:        hsla(34,85%,45%,1); }\n        .breadcrumb li:nth-child(2) a:after { border-left-color: hsla(34,85%,45%,1); }\n        .breadcrumb li:nth-child(3) a       { background:        hsla(34,85%,55%,1); }\n        .breadcrumb li:nth-child(3) a:after { border-left-color: hsla(34,85%,55%,1); }\n        .breadcrumb li:nth-child(4) a       { background:        hsla(34,85%,65%,1); }\n        .breadcrumb li:nth-child(4) a:after { border-left-color: hsla(34,85%,65%,1); }\n        .breadcrumb li:nth-child(5) a       { background:        hsla(34,85%,67%,1); }\n        .breadcrumb li:nth-child(5) a:after { border-left-color: hsla(34,85%,67%,1); }\n        .breadcrumb li:nth-child(6) a       { background:        hsla(34,85%,69%,1); }\n        .breadcrumb li:nth-child(6) a:after { border-left-color: hsla(34,85%,69%,1); }\n        .breadcrumb li:nth-child(7) a       { background:        hsla(34,85%,72%,1); }\n        .breadcrumb li:nth-child(7) a:after { border-left-color: hsla(34,85%,72%,1); }\n        .breadcrumb li:nth-child(8) a       { background:        hsla(34,85%,74%,1); }\n        .breadcrumb li:nth-child(8) a:after { border-left-color: hsla(34,85%,74%,1); }\n        .breadcrumb li:last-child a {\n            #background: transparent !important;\n            #color: black;\n            pointer-events: none;\n            cursor: default;\n        }\n\n        .breadcrumb li a:hover { background: hsla(34,85%,25%,1); }\n        .breadcrumb li a:hover:after { border-left-color: hsla(34,85%,25%,1) !important; }\n\n        /* CSSTerm.com Simple CSS menu */\n\n        #br { clear:left }\n\n        .menu_simple {\n            width: 100%;\n            background-color: #005555;\n        }\n\n        .menu_simple ul {\n            margin: 0; padding: 0;\n            float: left;\n        }\n\n        .menu_simple ul li {\n            display: inline;\n        }\n\n        .menu_simple ul li a {\n            float: left; text-decoration: none;\n            color: white;\n            padding: 10.5px 11px;\n            background-color: #417690;\n        }\n\n        .menu_simple ul li a:visited {\n            color: white;\n        }\n\n        .menu_simple ul li a:hover, .menu_simple ul li .current {\n            color: white;\n            background-color: #5FD367;\n        }\n    </style>\n</head>\n<body>\n\n    <div class=\"menu_simple\">\n    <ul>\n        <li><a href=\"/\">Main page</a></li>\n        <li><a href=\"/orgs/\">Organizations list</a></li>\n        <li><a href=\"/contacts\">Contacts</a></li>\n    </ul>\n    </div>\n    <div style=\"clear: both\"></div>\n\n\n<h1>Global OID reference database</h1>\n\n<p>This is full world OID database published for internet users</p>\n\n<h2>Root Tree Nodes</h2>\n<table>\n    <tr><th>Node</th><th>Name</th><th>Sub children</th><th>Sub Nodes Total</th><th>Description</th><th>Information</th></tr>\n    <tr><td><a href=\"/0\">0</a></td><td>itu-t, ccitt</td><td>7</td><td>10360</td><td>International Telecommunications Union - Telecommunication standardization sector (ITU-T)</td><td>Subsequent OIDs identify ITU-T Recommendations (not jointly published with ISO/IEC) and ITU members.<br>\n<br>\nThis arc is also called <code>ccitt(0)</code> to recall that CCITT used to be an organization independent from ITU-T.<br>\n<br>\nIdentifier <strong><code>itu-r</code></strong> was added by ITU-T Study Group 17 in March 2004 (and was ratified by ISO/IEC JTC 1/SC 6 in Sep 2005). It can only be used as a 'NameAndNumberForm' (that is, followed by number <code>5</code> between parentheses) for OIDs that commence with <code>{itu-r(0) <a href=\"https://oidref.com/0.5\">r-recommendation(5)</a>}</code> (see <a href=\"http://itu.int/rec/T-REC-X.680/en\">Rec. ITU-T X.680 | ISO/IEC 9834-1</a>, clause A.5, for more details on this specific case). Consequently Unicode label <code>ITU-R</code> can only be used for \"<a href=\"http://oid-info.com/faq.htm#iri\">OID-IRIs</a>\" that designate OIDs under the <code>{itu-r(0) <a href=\"https://oidref.com/0.5\">r-recommendation(5)</a>}</code> arc.<br>\n<br>\nOperation is in accordance with <a href=\"http://itu.int/rec/T-REC-X.660/en\">Rec. ITU-T X.660 | ISO/IEC 9834-1</a> and is under the guidance of <a href=\"http://itu.int/ITU-T/studygroups/com17/index.asp\">ITU-T Study Group 17</a>.<br>\n<br>\nAll decisions related to subsequent arcs, other than the assignment of additional secondary identifiers to top-level arc <code>0</code> (see Rec. ITU-T X.660 | ISO/IEC 9834-1, clause A.5), will be recorded ad amendments to Rec. ITU-T X.660 | ISO/IEC 9834-1 (such changes to the joint ITU-T | ISO/IEC text will be regarded as editorial by ISO).<br>\n<br>\nFrom Rec. ITU-T X.660 | ISO/IEC 9834-1, \"the top-level arcs are restricted to three arcs numbered <code>0</code> to <code>2</code>; and the arcs beneath root arcs <code>0</code> and <code>1</code> are restricted to forty arcs numbered <code>0</code> to <code>39</code>. This enables optimized encodings to be used in which the values of the top two arcs for all arcs under top-level arcs <code>0</code> and <code>1</code> encode in a single octet in an object identifier encoding (see the Rec. ITU-T X.690 series | ISO/IEC 8825 multi-part Standard).</td></tr>\n    <tr><td><a href=\"/1\">1</a></td><td>iso</td><td>4</td><td>992195</td><td>International Organization for Standardization (ISO)</td><td>This arc is for International Standards and ISO Member Bodies.<br>\n<br>\nOperation of this arc is in accordance with <a href=\"http://itu.int/ITU-T/X.660\">Rec. ITU-T X.660 | ISO/IEC 9834-1</a> \"<em>Procedures for the operation of object identifier registration authorities: General procedures and top arcs of the international object identifier tree</em>\".<br>\n<br>\nAll decisions related to subsequent arcs, other than the assignment of additional secondary identifiers to top-level arc <code>1</code> (see Rec. ITU-T X.660 (2004) | ISO/IEC 9834-1:2004, A.5), will be recorded as amendments to Rec. ITU-T X.660 | ISO/IEC 9834-1 (such changes to the common text will be regarded as editorial by ITU-T).<br>\n<br>\nFrom Rec. ITU-T X.660 (2004) | ISO/IEC 9834-1:2004, \"the top-level arcs are restricted to three arcs numbered 0 to 2; and the arcs beneath root arcs <code>0</code> and <code>1</code> are restricted to forty arcs numbered <code>0</code> to <code>39</code>. This enables optimized encodings to be used in which the values of the top two arcs for all arcs under top-level arcs <code>0</code> and <code>1</code> encode in a single octet in an object identifier encoding (see the Rec. ITU-T X.690 series | ISO/IEC 8825 multi-part Standard).</td></tr>\n    <tr><td><a href=\"/2\">2</a></td><td>joint-iso-itu-t, joint-iso-ccitt</td><td>38</td><td>25835</td><td>Common standardization area of ISO/IEC (International Organization for Standardization/International Electrotechnical Commission) and ITU-T (International Telecommunications Union - Telecommunication standardization sector)</td><td>This OID was allocated by <a href=\"http://itu.int/ITU-T/X.660\">Rec. ITU-T X.660</a> | ISO/IEC 9834-1.<br>\n<br>\nThis OID is jointly administered by ISO and ITU-T according to <a href=\"http://itu.int/ITU-T/X.662\">Rec. ITU-T X.662</a> | ISO/IEC 9834-3 \"<em>Procedures for the Operation of OSI Registration Authorities: Registration of Object Identifier Arcs for Joint ISO and ITU-T Work</em>\". As a consequence, all requests for registration must be jointly approved by ITU-T Study Group 17 and ISO/IEC JTC 1/SC 6. Child OIDs are recorded in the <a href=\"http://itu.int/go/X660\">Register of arcs beneath the root arc with primary integer value 2</a>.<br>\n<br>\nNew child OIDs will be allocated a number greater than 47, except if there is a good rationale that a compact binary encoding is needed, in which case a number less or equal to 47 can be allocated so that the OID encodes with a single octet.</td></tr>\n</table>\n\n\n\n\n</body>\n</html>",
 			expectedData: map[string]*models.TableInfo{
-				"/": {
-					Name:     "",
-					SubCh:    0,
-					SubTotal: 0,
-					Desc:     "",
-					Inf:      "",
-				},
 				"/0": {
 					Name:     "itu-t, ccitt",
 					SubCh:    7,
 					SubTotal: 10360,
 					Desc:     "International Telecommunications Union - Telecommunication standardization sector (ITU-T)",
-					Inf:      "Subsequent OIDs identify ITU-T Recommendations (not jointly published with ISO/IEC) and ITU members.",
+					Inf: "Subsequent OIDs identify ITU-T Recommendations (not jointly published with ISO/IEC) and ITU members.\n\n" +
+						"This arc is also called `ccitt(0)` to recall that CCITT used to be an organization independent from ITU-T.\n\n" +
+						"Identifier **`itu-r`** was added by ITU-T Study Group 17 in March 2004 (and was ratified by ISO/IEC JTC 1/SC 6 in Sep 2005). It can only be used as a 'NameAndNumberForm' (that is, followed by number `5` between parentheses) for OIDs that commence with `{itu-r(0) r-recommendation(5)}` (see [Rec. ITU-T X.680 | ISO/IEC 9834-1](http://itu.int/rec/T-REC-X.680/en), clause A.5, for more details on this specific case). Consequently Unicode label `ITU-R` can only be used for \"[OID-IRIs](http://oid-info.com/faq.htm#iri)\" that designate OIDs under the `{itu-r(0) r-recommendation(5)}` arc.\n\n" +
+						"Operation is in accordance with [Rec. ITU-T X.660 | ISO/IEC 9834-1](http://itu.int/rec/T-REC-X.660/en) and is under the guidance of [ITU-T Study Group 17](http://itu.int/ITU-T/studygroups/com17/index.asp).\n\n" +
+						"All decisions related to subsequent arcs, other than the assignment of additional secondary identifiers to top-level arc `0` (see Rec. ITU-T X.660 | ISO/IEC 9834-1, clause A.5), will be recorded ad amendments to Rec. ITU-T X.660 | ISO/IEC 9834-1 (such changes to the joint ITU-T | ISO/IEC text will be regarded as editorial by ISO).\n\n" +
+						"From Rec. ITU-T X.660 | ISO/IEC 9834-1, \"the top-level arcs are restricted to three arcs numbered `0` to `2`; and the arcs beneath root arcs `0` and `1` are restricted to forty arcs numbered `0` to `39`. This enables optimized encodings to be used in which the values of the top two arcs for all arcs under top-level arcs `0` and `1` encode in a single octet in an object identifier encoding (see the Rec. ITU-T X.690 series | ISO/IEC 8825 multi-part Standard).",
 				},
 				"/1": {
 					Name:     "iso",
 					SubCh:    4,
 					SubTotal: 992195,
 					Desc:     "International Organization for Standardization (ISO)",
-					Inf:      "This arc is for International Standards and ISO Member Bodies.",
+					Inf: "This arc is for International Standards and ISO Member Bodies.\n\n" +
+						"Operation of this arc is in accordance with [Rec. ITU-T X.660 | ISO/IEC 9834-1](http://itu.int/ITU-T/X.660) \"*Procedures for the operation of object identifier registration authorities: General procedures and top arcs of the international object identifier tree*\".\n\n" +
+						"All decisions related to subsequent arcs, other than the assignment of additional secondary identifiers to top-level arc `1` (see Rec. ITU-T X.660 (2004) | ISO/IEC 9834-1:2004, A.5), will be recorded as amendments to Rec. ITU-T X.660 | ISO/IEC 9834-1 (such changes to the common text will be regarded as editorial by ITU-T).\n\n" +
+						"From Rec. ITU-T X.660 (2004) | ISO/IEC 9834-1:2004, \"the top-level arcs are restricted to three arcs numbered 0 to 2; and the arcs beneath root arcs `0` and `1` are restricted to forty arcs numbered `0` to `39`. This enables optimized encodings to be used in which the values of the top two arcs for all arcs under top-level arcs `0` and `1` encode in a single octet in an object identifier encoding (see the Rec. ITU-T X.690 series | ISO/IEC 8825 multi-part Standard).",
 				}, "/2": {
 					Name:     "joint-iso-itu-t, joint-iso-ccitt",
 					SubCh:    38,
 					SubTotal: 25835,
 					Desc:     "Common standardization area of ISO/IEC (International Organization for Standardization/International Electrotechnical Commission) and ITU-T (International Telecommunications Union - Telecommunication standardization sector)",
-					Inf:      "This OID was allocated by ",
+					Inf: "This OID was allocated by [Rec. ITU-T X.660](http://itu.int/ITU-T/X.660) | ISO/IEC 9834-1.\n\n" +
+						"This OID is jointly administered by ISO and ITU-T according to [Rec. ITU-T X.662](http://itu.int/ITU-T/X.662) | ISO/IEC 9834-3 \"*Procedures for the Operation of OSI Registration Authorities: Registration of Object Identifier Arcs for Joint ISO and ITU-T Work*\". As a consequence, all requests for registration must be jointly approved by ITU-T Study Group 17 and ISO/IEC JTC 1/SC 6. Child OIDs are recorded in the [Register of arcs beneath the root arc with primary integer value 2](http://itu.int/go/X660).\n\n" +
+						"New child OIDs will be allocated a number greater than 47, except if there is a good rationale that a compact binary encoding is needed, in which case a number less or equal to 47 can be allocated so that the OID encodes with a single octet.",
 				}},
 		},
 		{
@@ -69,18 +78,166 @@ func TestParser_filter(t *testing.T) {
 			body:         "error text",
 			expectedData: make(map[string]*models.TableInfo, 10),
 		},
+		{
+			name: "columns by header",
+			body: `<table><thead><tr><th> OID </th><th>Sub
+				Nodes   Total</th><th>Name</th><th>Notes</th></tr></thead>
+				<tbody><tr><td>
+					<a title="iso" href="https://oidref.com/1.3">1.3</a>
+				</td><td>1,024</td><td> org </td><td>ignored</td></tr></tbody></table>`,
+			expectedData: map[string]*models.TableInfo{
+				"/1.3": {Name: "org", SubTotal: 1024},
+			},
+		},
+		{
+			name: "brothers",
+			body: `<table><tr><th>Node</th><th>Name</th></tr><tr><td><a href="/1.3.6">1.3.6</a></td><td>dod</td></tr></table>
+				<h3>Brothers (2)</h3>
+				<table><tr><th><b>OID</b></th><th>Name</th></tr>
+				<tr><td><a href="/1.2">1.2</a></td><td>member-body</td></tr>
+				<tr><td><a href="/1.0">1.0</a></td><td>standard</td></tr></table>`,
+			expectedData: map[string]*models.TableInfo{
+				"/1.3.6": {Name: "dod"},
+			},
+			siblings: []string{"/1.2", "/1.0"},
+		},
+		{
+			name: "malformed rows",
+			body: `<table><tr><th>Node</th><th>Name</th><th>Sub children</th></tr>
+				<tr><td><a href="/1.1">1.1</a></td><td>standard</td><td>2</td></tr>
+				<tr><td><a href="/1.2">1.2</a></td><td>member-body</td></tr>
+				<tr><td><a>1.3</a></td><td>org</td><td>1</td></tr>
+				<tr><td><a href="/1.4">1.4</a></td><td>four</td><td>many</td></tr>
+				<tr><td><a href="/mib/1.5">1.5</a></td><td>five</td><td>0</td></tr>
+				<tr><td><a href="/1.6">1.6</a></td><td></td><td>0</td></tr>
+				<tr><td></td><td></td><td></td></tr>
+				<tr></tr>
+				<tr><td><a href="/1.7">1.7</a></td><td>seven</td><td></td></tr>
+				</table>`,
+			expectedData: map[string]*models.TableInfo{
+				"/1.1": {Name: "standard", SubCh: 2},
+				"/1.7": {Name: "seven"},
+			},
+			malformed: 7,
+		},
+		{
+			name: "no oid tables",
+			body: `<table><tr><td><a href="/1.1">1.1</a></td></tr></table>
+				<table><tr><th>Name</th></tr><tr><td>x</td></tr></table>`,
+			expectedData: make(map[string]*models.TableInfo, 10),
+		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			data, err := parser.filter([]byte(tt.body))
+			found, err := parser.filter([]byte(tt.body))
+			require.NotNil(t, found)
+			data := found.records
 
-			assert.Equal(t, data, tt.expectedData)
-			assert.NoError(t, err)
+			assert.Equal(t, tt.siblings, found.siblings)
+			assert.Equal(t, tt.expectedData, data)
+			if tt.malformed == 0 {
+				assert.NoError(t, err)
+				return
+			}
+			var malformed *MalformedRowsError
+			require.ErrorAs(t, err, &malformed)
+			assert.Len(t, malformed.Rows, tt.malformed)
 		})
 	}
 }
 
+func TestParser_parsePageSiblings(t *testing.T) {
+	parser := NewOIDParser(http.DefaultClient, "oidscraper", nil, RetryPolicy{})
+	body := `<table><tr><th>Node</th><th>Name</th></tr><tr><td><a href="/1.3.6">1.3.6</a></td><td>dod</td></tr></table>
+		<h3>Brothers (3)</h3>
+		<table><tr><th>Node</th><th>Name</th></tr>
+		<tr><td><a href="/1.2">1.2</a></td><td>member-body</td></tr>
+		<tr><td><a href="/1.3">1.3</a></td><td>org</td></tr>
+		<tr><td><a href="/2.1">2.1</a></td><td>asn1</td></tr></table>`
+
+	page, err := parser.parsePage("/1.3", []byte(body))
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"/1.2"}, page.Siblings)
+	assert.Equal(t, []string{"/1.3.6"}, page.Children)
+	assert.Equal(t, []string{"/1.3.6"}, page.Links)
+}
+
+func TestParser_filterDetails(t *testing.T) {
+	parser := NewOIDParser(http.DefaultClient, "oidscraper", nil, RetryPolicy{})
+	body := `<h1>OID 1.3.6</h1>
+		<dl>
+			<dt>ASN.1 notation</dt><dd><code>{iso(1) identified-organization(3) dod(6)}</code></dd>
+			<dt>Dot notation</dt><dd>1.3.6</dd>
+			<dt>OID-IRI notation</dt><dd>/ISO/Identified-Organization/6</dd>
+			<dt>Description</dt><dd>US Department of Defense</dd>
+			<dt>Registration Authority</dt><dd><a href="/orgs/12">DoD Network Information Center</a></dd>
+			<dt>Creation date</dt><dd>Sept. 5, 2016, 3:04 p.m.</dd>
+			<dt>Modification date</dt><dd>2022-08-20</dd>
+		</dl>
+		<h3>Brothers (1)</h3>
+		<dl><dt>Creation date</dt><dd>2000-01-01</dd></dl>`
+
+	found, err := parser.filter([]byte(body))
+	require.NoError(t, err)
+
+	assert.Equal(t, &models.OidDetails{
+		ASN1:      "{iso(1) identified-organization(3) dod(6)}",
+		IRI:       "/ISO/Identified-Organization/6",
+		Dot:       "1.3.6",
+		Authority: "DoD Network Information Center",
+		Created:   time.Date(2016, 9, 5, 15, 4, 0, 0, time.UTC),
+		Modified:  time.Date(2022, 8, 20, 0, 0, 0, 0, time.UTC),
+	}, found.details)
+
+	found, err = parser.filter([]byte(`<dl><dt>Dot notation</dt><dd>1.3</dd><dt>Creation date</dt><dd>soon</dd></dl>`))
+	require.NoError(t, err)
+	assert.Len(t, found.invalid, 1)
+	assert.Equal(t, &models.OidDetails{Dot: "1.3"}, found.details)
+
+	found, err = parser.filter([]byte(`<dl><dt>Description</dt><dd>none</dd></dl>`))
+	require.NoError(t, err)
+	assert.Nil(t, found.details)
+
+	found, err = parser.filter([]byte(`<dl><dt>Creation date</dt><dd>March 3, 2010, noon</dd>
+		<dt>Modification date</dt><dd>Jan. 5, 2011, midnight</dd></dl>`))
+	require.NoError(t, err)
+	assert.Equal(t, &models.OidDetails{
+		Created:  time.Date(2010, 3, 3, 12, 0, 0, 0, time.UTC),
+		Modified: time.Date(2011, 1, 5, 0, 0, 0, 0, time.UTC),
+	}, found.details)
+}
+
+func TestParser_parsePageMalformed(t *testing.T) {
+	parser := NewOIDParser(http.DefaultClient, "oidscraper", nil, RetryPolicy{})
+	body := `<table><tr><th>Node</th><th>Name</th><th>Sub children</th></tr>
+		<tr><td><a href="/1.2">1.2</a></td><td>member-body</td><td>many</td></tr>
+		<tr><td><a href="/1.3">1.3</a></td><td>org</td><td>1</td></tr></table>`
+
+	page, err := parser.parsePage("/1", []byte(body))
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"/1.3"}, page.Links)
+	assert.Contains(t, page.Records, "/1.3")
+	// /1.2 is still there, its row just could not be read
+	assert.Empty(t, page.Children)
+}
+
+func TestParser_parsePageInvalidDetail(t *testing.T) {
+	parser := NewOIDParser(http.DefaultClient, "oidscraper", nil, RetryPolicy{})
+	body := `<dl><dt>Dot notation</dt><dd>1</dd><dt>Creation date</dt><dd>20/08/2022</dd></dl>
+		<table><tr><th>Node</th><th>Name</th></tr>
+		<tr><td><a href="/1.3">1.3</a></td><td>org</td></tr></table>`
+
+	page, err := parser.parsePage("/1", []byte(body))
+	require.NoError(t, err)
+
+	assert.Equal(t, &models.OidDetails{Dot: "1"}, page.Details)
+	// a date it could not read says nothing about the rows
+	assert.Equal(t, []string{"/1.3"}, page.Children)
+}
+
 func TestParser_getBody(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
@@ -95,11 +252,24 @@ func TestParser_getBody(t *testing.T) {
 			name: "success",
 			init: func(mockHttpClient *scrapers.MockHTTPClient) {
 				r := strings.NewReader("")
-				mockHttpClient.EXPECT().Do(gomock.Any()).Return(&http.Response{Body: io.NopCloser(r)}, nil)
+				mockHttpClient.EXPECT().Do(gomock.Any()).Return(&http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(r)}, nil)
 			},
 			url:   "/",
 			error: nil,
 		},
+		{
+			name: "not found",
+			init: func(mockHttpClient *scrapers.MockHTTPClient) {
+				r := strings.NewReader("<html>not found</html>")
+				mockHttpClient.EXPECT().Do(gomock.Any()).Return(&http.Response{
+					StatusCode: http.StatusNotFound,
+					Status:     "404 Not Found",
+					Body:       io.NopCloser(r),
+				}, nil)
+			},
+			url:   "/9.9",
+			error: errors.New("unexpected status 404 Not Found"),
+		},
 		{
 			name: "request error",
 			init: func(mockHttpClient *scrapers.MockHTTPClient) {
@@ -114,9 +284,9 @@ func TestParser_getBody(t *testing.T) {
 		t.Run(tt.name, func(t *testing.T) {
 			mockHttpClient := scrapers.NewMockHTTPClient(ctrl)
 			tt.init(mockHttpClient)
-			parser := NewOIDParser(&sync.Map{}, mockHttpClient)
+			parser := NewOIDParser(mockHttpClient, "oidscraper", nil, RetryPolicy{})
 
-			_, err := parser.getBody(tt.url)
+			_, err := parser.getBody(context.Background(), tt.url, nil)
 			if tt.error != nil {
 				assert.EqualError(t, err, tt.error.Error())
 			} else {
@@ -126,62 +296,28 @@ func TestParser_getBody(t *testing.T) {
 	}
 }
 
-func TestParser_mapToTable(t *testing.T) {
-	tests := []struct {
-		name     string
-		data     []string
-		expected *models.TableInfo
-	}{
-		{
-			name: "1",
-			data: []string{"1"},
-			expected: &models.TableInfo{
-				Name: "1",
-			},
-		},
-		{
-			name: "2",
-			data: []string{"1", "0"},
-			expected: &models.TableInfo{
-				Name:  "1",
-				SubCh: 0,
-			},
-		},
-		{
-			name: "3",
-			data: []string{"1", "0", "10"},
-			expected: &models.TableInfo{
-				Name:     "1",
-				SubCh:    0,
-				SubTotal: 10,
-			},
-		},
-		{
-			name: "4",
-			data: []string{"1", "0", "10", "description"},
-			expected: &models.TableInfo{
-				Name:     "1",
-				SubCh:    0,
-				SubTotal: 10,
-				Desc:     "description",
-			},
-		},
-		{
-			name: "5",
-			data: []string{"1", "0", "10", "description", "inf"},
-			expected: &models.TableInfo{
-				Name:     "1",
-				SubCh:    0,
-				SubTotal: 10,
-				Desc:     "description",
-				Inf:      "inf",
-			},
-		},
-	}
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			model := mapToTableInfo(tt.data)
-			assert.Equal(t, tt.expected, model)
-		})
-	}
+func TestParser_getBodyConditional(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockHttpClient := scrapers.NewMockHTTPClient(ctrl)
+	mockHttpClient.EXPECT().Do(gomock.Any()).DoAndReturn(func(req *http.Request) (*http.Response, error) {
+		assert.Equal(t, "oidscraper", req.Header.Get("User-Agent"))
+		assert.Equal(t, `"abc"`, req.Header.Get("If-None-Match"))
+		assert.Equal(t, "Sat, 20 Aug 2022 12:00:00 GMT", req.Header.Get("If-Modified-Since"))
+		return &http.Response{
+			StatusCode: http.StatusNotModified,
+			Header:     http.Header{"Etag": []string{`"abc"`}},
+			Body:       io.NopCloser(strings.NewReader("")),
+		}, nil
+	})
+	parser := NewOIDParser(mockHttpClient, "oidscraper", nil, RetryPolicy{})
+
+	result, err := parser.getBody(context.Background(), baseUrl+"/1", &models.FrontierItem{
+		Oid:          "/1",
+		ETag:         `"abc"`,
+		LastModified: "Sat, 20 Aug 2022 12:00:00 GMT",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, &fetchResult{etag: `"abc"`, lastModified: "Sat, 20 Aug 2022 12:00:00 GMT", notModified: true}, result)
 }
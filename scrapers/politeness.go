@@ -0,0 +1,195 @@
+package scrapers
+
+import (
+	"context"
+	"io"
+	"math/rand"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// PolitenessConfig describes how hard a single host may be hit.
+type PolitenessConfig struct {
+	// RequestsPerSecond is the steady request rate per host; zero or less
+	// means no limit.
+	RequestsPerSecond float64
+	// Burst is how many requests may go out back to back before the rate kicks in.
+	Burst int
+	// Jitter is the upper bound of a random delay added before every request.
+	Jitter time.Duration
+	// MaxConnsPerHost caps the requests to a host that are open at the same
+	// time, body reads included; zero or less means no cap.
+	MaxConnsPerHost int
+}
+
+// PoliteClient wraps an HTTPClient with a per-host token bucket, a random
+// jitter and a per-host connection cap. A single PoliteClient is meant to be
+// shared by every walker.
+type PoliteClient struct {
+	client HTTPClient
+	cfg    PolitenessConfig
+
+	mu    sync.Mutex
+	hosts map[string]*hostPolicy
+}
+
+type hostPolicy struct {
+	bucket *tokenBucket
+	conns  chan struct{}
+}
+
+func NewPoliteClient(client HTTPClient, cfg PolitenessConfig) *PoliteClient {
+	return &PoliteClient{
+		client: client,
+		cfg:    cfg,
+		hosts:  make(map[string]*hostPolicy),
+	}
+}
+
+func (c *PoliteClient) Do(req *http.Request) (*http.Response, error) {
+	ctx := req.Context()
+	host := c.host(req.URL.Host)
+
+	if host.conns != nil {
+		select {
+		case host.conns <- struct{}{}:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+
+	err := host.bucket.Wait(ctx)
+	if err == nil && c.cfg.Jitter > 0 {
+		err = sleep(ctx, time.Duration(rand.Int63n(int64(c.cfg.Jitter))))
+	}
+	if err != nil {
+		c.releaseConn(host)
+		return nil, err
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil || resp.Body == nil {
+		c.releaseConn(host)
+		return resp, err
+	}
+	resp.Body = &releasingBody{ReadCloser: resp.Body, release: func() { c.releaseConn(host) }}
+
+	return resp, nil
+}
+
+// SetInterval slows requests to host down to at most one per interval. It
+// never speeds a host up past the configured rate.
+func (c *PoliteClient) SetInterval(host string, interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+	c.host(host).bucket.Limit(float64(time.Second) / float64(interval))
+}
+
+func (c *PoliteClient) host(name string) *hostPolicy {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	host, ok := c.hosts[name]
+	if !ok {
+		host = &hostPolicy{bucket: newTokenBucket(c.cfg.RequestsPerSecond, c.cfg.Burst)}
+		if c.cfg.MaxConnsPerHost > 0 {
+			host.conns = make(chan struct{}, c.cfg.MaxConnsPerHost)
+		}
+		c.hosts[name] = host
+	}
+
+	return host
+}
+
+func (c *PoliteClient) releaseConn(host *hostPolicy) {
+	if host.conns != nil {
+		<-host.conns
+	}
+}
+
+// releasingBody gives the connection slot back once the body is closed.
+type releasingBody struct {
+	io.ReadCloser
+	once    sync.Once
+	release func()
+}
+
+func (b *releasingBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.once.Do(b.release)
+	return err
+}
+
+// tokenBucket lets rate requests a second through on average and up to
+// burst of them at once.
+type tokenBucket struct {
+	mu     sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func newTokenBucket(rate float64, burst int) *tokenBucket {
+	if burst < 1 {
+		burst = 1
+	}
+	return &tokenBucket{rate: rate, burst: float64(burst), tokens: float64(burst), last: time.Now()}
+}
+
+// Wait blocks until a token is available or ctx is done.
+func (b *tokenBucket) Wait(ctx context.Context) error {
+	for {
+		b.mu.Lock()
+		if b.rate <= 0 {
+			b.mu.Unlock()
+			return nil
+		}
+		now := time.Now()
+		b.tokens += now.Sub(b.last).Seconds() * b.rate
+		if b.tokens > b.burst {
+			b.tokens = b.burst
+		}
+		b.last = now
+		if b.tokens >= 1 {
+			b.tokens--
+			b.mu.Unlock()
+			return nil
+		}
+		wait := time.Duration((1 - b.tokens) / b.rate * float64(time.Second))
+		b.mu.Unlock()
+
+		err := sleep(ctx, wait)
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// Limit lowers the rate of the bucket to rate if it is currently faster.
+func (b *tokenBucket) Limit(rate float64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.rate <= 0 || rate < b.rate {
+		b.rate = rate
+	}
+}
+
+// sleep waits for d or until ctx is done, whichever comes first.
+func sleep(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
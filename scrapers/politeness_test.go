@@ -0,0 +1,83 @@
+package scrapers
+
+import (
+	"context"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	scrapers "hello/scraper/scrapers/mock"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestTokenBucket_Wait(t *testing.T) {
+	bucket := newTokenBucket(50, 2)
+
+	started := time.Now()
+	for i := 0; i < 6; i++ {
+		require.NoError(t, bucket.Wait(context.Background()))
+	}
+
+	// two tokens come for free, the other four at 20ms each
+	assert.GreaterOrEqual(t, time.Since(started), 70*time.Millisecond)
+}
+
+func TestTokenBucket_WaitCancelled(t *testing.T) {
+	bucket := newTokenBucket(0.1, 1)
+	require.NoError(t, bucket.Wait(context.Background()))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, bucket.Wait(ctx), context.DeadlineExceeded)
+}
+
+func TestPoliteClient_MaxConnsPerHost(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	var open, maxOpen int64
+	mockHttpClient := scrapers.NewMockHTTPClient(ctrl)
+	mockHttpClient.EXPECT().Do(gomock.Any()).DoAndReturn(func(*http.Request) (*http.Response, error) {
+		n := atomic.AddInt64(&open, 1)
+		for {
+			m := atomic.LoadInt64(&maxOpen)
+			if n <= m || atomic.CompareAndSwapInt64(&maxOpen, m, n) {
+				break
+			}
+		}
+		time.Sleep(5 * time.Millisecond)
+		body := &closeHook{Reader: strings.NewReader(""), close: func() { atomic.AddInt64(&open, -1) }}
+		return &http.Response{Body: body}, nil
+	}).Times(8)
+
+	client := NewPoliteClient(mockHttpClient, PolitenessConfig{MaxConnsPerHost: 2})
+	wg := &sync.WaitGroup{}
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			req, _ := http.NewRequest("GET", "https://oidref.com/1", nil)
+			resp, err := client.Do(req)
+			require.NoError(t, err)
+			resp.Body.Close()
+		}()
+	}
+	wg.Wait()
+
+	assert.LessOrEqual(t, maxOpen, int64(2))
+}
+
+type closeHook struct {
+	io.Reader
+	close func()
+}
+
+func (c *closeHook) Close() error {
+	c.close()
+	return nil
+}
@@ -0,0 +1,153 @@
+package scrapers
+
+import (
+	"context"
+	"hello/scraper/models"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// AdaptiveConfig lets the scraper resize its worker pools while it runs.
+// Walkers grow one at a time while fetches are fast and mostly succeed and
+// are halved as soon as the latency or the error rate gets too high.
+// Digesters follow the number of pages waiting to be saved.
+type AdaptiveConfig struct {
+	MinWalkers   int
+	MaxWalkers   int
+	MinDigesters int
+	MaxDigesters int
+	// Interval is how often the pools are looked at.
+	Interval time.Duration
+	// TargetLatency is the average fetch time above which walkers are
+	// taken away; zero ignores latency.
+	TargetLatency time.Duration
+	// MaxErrorRate is the share of failed fetches above which walkers are
+	// taken away; zero ignores errors.
+	MaxErrorRate float64
+}
+
+// pool runs a resizable number of workers. run does the work of a single
+// worker and returns once it is told to stop by stop, or on its own.
+type pool struct {
+	run  func()
+	stop func()
+
+	mu   sync.Mutex
+	size int
+	// stopping counts the workers told to stop that did not return yet;
+	// they are no longer part of size
+	stopping int
+	wg       sync.WaitGroup
+}
+
+func newPool(run func(), stop func()) *pool {
+	return &pool{run: run, stop: stop}
+}
+
+// resize starts or stops workers until n of them are running.
+func (p *pool) resize(n int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for ; p.size < n; p.size++ {
+		p.wg.Add(1)
+		go func() {
+			defer p.wg.Done()
+			p.run()
+			p.done()
+		}()
+	}
+	for ; p.size > n; p.size-- {
+		p.stopping++
+		go p.stop()
+	}
+}
+
+// done takes a returning worker off the count. Which worker a stop reached
+// is unknown, so workers returning on their own first settle pending stops;
+// the stop then ends a worker that counts as running.
+func (p *pool) done() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.stopping > 0 {
+		p.stopping--
+	} else {
+		p.size--
+	}
+}
+
+func (p *pool) len() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.size
+}
+
+// wait blocks until every worker has returned.
+func (p *pool) wait() {
+	p.wg.Wait()
+}
+
+// adapt resizes the walker and digester pools every Interval until ctx is done.
+func (s *OIDScraper) adapt(ctx context.Context, pages chan *models.Page) {
+	cfg := s.cfg.Adaptive
+	ticker := time.NewTicker(cfg.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		fetched := atomic.SwapInt64(&s.windowPages, 0)
+		failed := atomic.SwapInt64(&s.windowErrors, 0)
+		elapsed := atomic.SwapInt64(&s.windowLatency, 0)
+
+		walkers := s.walkers.len()
+		if fetched > 0 {
+			errorRate := float64(failed) / float64(fetched)
+			latency := time.Duration(elapsed / fetched)
+			if cfg.MaxErrorRate > 0 && errorRate > cfg.MaxErrorRate || cfg.TargetLatency > 0 && latency > cfg.TargetLatency {
+				walkers /= 2
+			} else {
+				walkers++
+			}
+		}
+		walkers = clamp(walkers, cfg.MinWalkers, cfg.MaxWalkers)
+
+		digesters := s.digesters.len()
+		switch {
+		case len(pages) > cap(pages)/2:
+			digesters++
+		case len(pages) == 0:
+			digesters--
+		}
+		digesters = clamp(digesters, cfg.MinDigesters, cfg.MaxDigesters)
+
+		if walkers != s.walkers.len() || digesters != s.digesters.len() {
+			log.Printf("Resizing pools to %d walkers and %d digesters after %d fetches, %d failed",
+				walkers, digesters, fetched, failed)
+		}
+		s.walkers.resize(walkers)
+		s.digesters.resize(digesters)
+	}
+}
+
+// clamp keeps n between min and max, and at one worker at least.
+func clamp(n, min, max int) int {
+	if n > max {
+		n = max
+	}
+	if n < min {
+		n = min
+	}
+	if n < 1 {
+		n = 1
+	}
+	return n
+}
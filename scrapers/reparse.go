@@ -0,0 +1,111 @@
+package scrapers
+
+import (
+	"context"
+	"hello/scraper/models"
+	"log"
+	"time"
+)
+
+// ArchiveDb is what a Reparser needs from the database.
+type ArchiveDb interface {
+	LatestArchived(*models.Scope) ([]*models.ArchivedPage, error)
+	ArchivedBody(string) ([]byte, error)
+	SaveRecords(int64, *models.Page) (*models.SaveResult, error)
+	StartRun(string) (int64, error)
+	FinishRun(int64, *models.CrawlResult) error
+}
+
+// Reparser rebuilds records from the page archive instead of the network, so
+// parser fixes reach the data without crawling again.
+type Reparser struct {
+	db     ArchiveDb
+	parser *OidParser
+	scope  *models.Scope
+	config string
+}
+
+// NewReparser creates a reparser for the pages scope wants fetched. config
+// describes its settings for the run record.
+func NewReparser(db ArchiveDb, parser *OidParser, scope *models.Scope, config string) *Reparser {
+	return &Reparser{
+		db:     db,
+		parser: parser,
+		scope:  scope,
+		config: config,
+	}
+}
+
+// Run parses the latest archived fetch of every page in scope again and saves
+// the records as a run of its own. PagesFetched counts the pages parsed. The
+// returned SaveResult lists every record the run inserted, changed or
+// tombstoned.
+func (r *Reparser) Run(ctx context.Context) (*models.CrawlResult, *models.SaveResult, error) {
+	started := time.Now()
+	archived, err := r.db.LatestArchived(r.scope)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	result := &models.CrawlResult{ExitReason: models.ExitCompleted}
+	result.RunID, err = r.db.StartRun(r.config)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	changes := &models.SaveResult{}
+	err = r.reparse(ctx, archived, result, changes)
+	switch {
+	case ctx.Err() != nil:
+		result.ExitReason = models.ExitInterrupted
+		err = nil
+	case err != nil:
+		result.ExitReason = models.ExitError
+	}
+
+	result.Duration = time.Since(started)
+	log.Printf("Run %d reparsed %d of %d archived pages in %v (%v): %d records inserted, %d updated, %d tombstoned, "+
+		"%d failures", result.RunID, result.PagesFetched, len(archived), result.Duration.Round(time.Second),
+		result.ExitReason, result.RecordsInserted, result.RecordsUpdated, result.RecordsTombstoned, result.Failures)
+
+	finishErr := r.db.FinishRun(result.RunID, result)
+	if err == nil {
+		err = finishErr
+	}
+	return result, changes, err
+}
+
+func (r *Reparser) reparse(ctx context.Context, archived []*models.ArchivedPage, result *models.CrawlResult,
+	changes *models.SaveResult) error {
+	for _, a := range archived {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		body, err := r.db.ArchivedBody(a.Hash)
+		if err != nil {
+			return err
+		}
+		page, err := r.parser.parsePage(a.Oid, body)
+		if err != nil {
+			result.Failures++
+			log.Printf("Couldn`t parse archived page %v: %v", a.Oid, err)
+			continue
+		}
+		scopePage(r.scope, page)
+
+		saved, err := r.db.SaveRecords(result.RunID, page)
+		if err != nil {
+			return err
+		}
+		result.PagesFetched++
+		result.RecordsInserted += int64(len(saved.Inserted))
+		result.RecordsUpdated += int64(len(saved.Updated))
+		result.RecordsTombstoned += int64(len(saved.Tombstoned))
+		changes.Inserted = append(changes.Inserted, saved.Inserted...)
+		changes.Updated = append(changes.Updated, saved.Updated...)
+		changes.Tombstoned = append(changes.Tombstoned, saved.Tombstoned...)
+	}
+
+	return nil
+}
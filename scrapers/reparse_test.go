@@ -0,0 +1,88 @@
+package scrapers
+
+import (
+	"context"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"hello/scraper/models"
+	"testing"
+)
+
+const archivedPage = `<html><body><a href="/">/</a><table>
+<tr><th>OID</th><th>Name</th><th>Sub children</th><th>Sub Nodes Total</th><th>Description</th><th>Information</th></tr>
+<tr><td><a href="/1.3">1.3</a></td><td>identified-organization</td><td>120</td><td>900000</td><td>Identified organization</td><td>ISO 6523</td></tr>
+<tr><td><a href="/1.3.9">1.3.9</a></td><td>example</td><td>0</td><td>0</td><td>Example</td><td>-</td></tr>
+</table></body></html>`
+
+type archiveDb struct {
+	pages  map[string]string
+	saved  []*models.Page
+	result *models.CrawlResult
+}
+
+func (a *archiveDb) LatestArchived(scope *models.Scope) ([]*models.ArchivedPage, error) {
+	var pages []*models.ArchivedPage
+	for oid := range a.pages {
+		if scope.Follow(oid) {
+			pages = append(pages, &models.ArchivedPage{Oid: oid, Hash: oid})
+		}
+	}
+	return pages, nil
+}
+
+func (a *archiveDb) ArchivedBody(hash string) ([]byte, error) {
+	body, ok := a.pages[hash]
+	if !ok {
+		return nil, errors.New("no such blob")
+	}
+	return []byte(body), nil
+}
+
+func (a *archiveDb) SaveRecords(_ int64, page *models.Page) (*models.SaveResult, error) {
+	a.saved = append(a.saved, page)
+	result := &models.SaveResult{}
+	for oid := range page.Records {
+		result.Updated = append(result.Updated, oid)
+	}
+	return result, nil
+}
+
+func (a *archiveDb) StartRun(string) (int64, error) {
+	return 7, nil
+}
+
+func (a *archiveDb) FinishRun(_ int64, result *models.CrawlResult) error {
+	a.result = result
+	return nil
+}
+
+func TestReparser_Run(t *testing.T) {
+	db := &archiveDb{pages: map[string]string{"/1": archivedPage, "/2": "<html></html>"}}
+	parser := NewOIDParser(nil, "oidscraper", nil, RetryPolicy{})
+	scope := models.NewScope([]string{"1"}, 0, []string{"1.3.9"})
+
+	result, changes, err := NewReparser(db, parser, scope, "").Run(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, models.ExitCompleted, result.ExitReason)
+	assert.Equal(t, int64(7), result.RunID)
+	assert.Equal(t, int64(1), result.PagesFetched)
+	assert.Equal(t, result, db.result)
+	assert.Equal(t, []string{"/1.3"}, changes.Updated)
+
+	require.Len(t, db.saved, 1)
+	assert.Equal(t, "/1", db.saved[0].Oid)
+	assert.Equal(t, "identified-organization", db.saved[0].Records["/1.3"].Name)
+}
+
+func TestReparser_RunInterrupted(t *testing.T) {
+	db := &archiveDb{pages: map[string]string{"/1": archivedPage}}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	result, changes, err := NewReparser(db, NewOIDParser(nil, "oidscraper", nil, RetryPolicy{}), nil, "").Run(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, models.ExitInterrupted, result.ExitReason)
+	assert.Empty(t, changes.Updated)
+	assert.Empty(t, db.saved)
+}
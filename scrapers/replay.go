@@ -0,0 +1,167 @@
+package scrapers
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"hello/scraper/models"
+	"hello/scraper/warc"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ErrNoRecording is returned by a strict ReplayClient for urls it has no
+// recording of. It stops the crawl instead of failing a single url.
+var ErrNoRecording = errors.New("no recording")
+
+// Recordings looks up the recorded response for a request, nil when there
+// is none.
+type Recordings interface {
+	Replay(req *http.Request) (*http.Response, error)
+}
+
+// ReplayClient answers requests from recordings instead of the network, so
+// a crawl can be repeated offline and always sees the same pages. Urls
+// without a recording get a 404, or ErrNoRecording in strict mode.
+type ReplayClient struct {
+	recordings Recordings
+	strict     bool
+}
+
+func NewReplayClient(recordings Recordings, strict bool) *ReplayClient {
+	return &ReplayClient{
+		recordings: recordings,
+		strict:     strict,
+	}
+}
+
+func (c *ReplayClient) Do(req *http.Request) (*http.Response, error) {
+	if err := req.Context().Err(); err != nil {
+		return nil, err
+	}
+
+	response, err := c.recordings.Replay(req)
+	if err != nil {
+		return nil, err
+	}
+	if response != nil {
+		response.Request = req
+		return response, nil
+	}
+	if c.strict {
+		return nil, fmt.Errorf("%w of %v", ErrNoRecording, req.URL)
+	}
+
+	return newResponse(req, http.StatusNotFound, nil), nil
+}
+
+func newResponse(req *http.Request, status int, body []byte) *http.Response {
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", status, http.StatusText(status)),
+		StatusCode:    status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        http.Header{"Content-Type": {"text/html; charset=utf-8"}},
+		Body:          io.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}
+}
+
+// ArchiveLookup finds archived fetches by url.
+type ArchiveLookup interface {
+	LatestFetch(url string) (*models.ArchivedPage, error)
+}
+
+// ArchiveRecordings replays the latest archived fetch of every url.
+type ArchiveRecordings struct {
+	db ArchiveLookup
+}
+
+func NewArchiveRecordings(db ArchiveLookup) *ArchiveRecordings {
+	return &ArchiveRecordings{db: db}
+}
+
+func (a *ArchiveRecordings) Replay(req *http.Request) (*http.Response, error) {
+	page, err := a.db.LatestFetch(req.URL.String())
+	if err != nil || page == nil {
+		return nil, err
+	}
+
+	return newResponse(req, http.StatusOK, page.Body), nil
+}
+
+// WARCRecordings replays the latest response recorded for every url in the
+// WARC files of a directory. The responses are held in memory.
+type WARCRecordings struct {
+	responses map[string]*warc.Record
+}
+
+// LoadWARCRecordings reads every .warc and .warc.gz file in dir.
+func LoadWARCRecordings(dir string) (*WARCRecordings, error) {
+	w := &WARCRecordings{responses: make(map[string]*warc.Record)}
+	for _, pattern := range []string{"*.warc", "*.warc.gz"} {
+		files, err := filepath.Glob(filepath.Join(dir, pattern))
+		if err != nil {
+			return nil, err
+		}
+		for _, name := range files {
+			err = w.load(name)
+			if err != nil {
+				return nil, fmt.Errorf("cant load %v: %v", name, err)
+			}
+		}
+	}
+	log.Printf("Loaded recordings of %d urls from %v", len(w.responses), dir)
+
+	return w, nil
+}
+
+func (w *WARCRecordings) load(name string) error {
+	file, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	reader, err := warc.NewReader(file)
+	if err != nil {
+		return err
+	}
+	for {
+		record, err := reader.ReadRecord()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if record.Type() != warc.TypeResponse {
+			continue
+		}
+
+		uri := strings.Trim(record.TargetURI(), "<>")
+		if known, ok := w.responses[uri]; !ok || !record.Date().Before(known.Date()) {
+			w.responses[uri] = record
+		}
+	}
+}
+
+func (w *WARCRecordings) Replay(req *http.Request) (*http.Response, error) {
+	record, ok := w.responses[req.URL.String()]
+	if !ok {
+		return nil, nil
+	}
+
+	response, err := http.ReadResponse(bufio.NewReader(bytes.NewReader(record.Block)), req)
+	if err != nil {
+		return nil, fmt.Errorf("cant read recorded response of %v: %v", req.URL, err)
+	}
+	return response, nil
+}
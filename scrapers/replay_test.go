@@ -0,0 +1,82 @@
+package scrapers
+
+import (
+	"context"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"hello/scraper/models"
+	"hello/scraper/warc"
+	"io"
+	"net/http"
+	"testing"
+	"time"
+)
+
+type archiveLookup map[string]string
+
+func (a archiveLookup) LatestFetch(url string) (*models.ArchivedPage, error) {
+	body, ok := a[url]
+	if !ok {
+		return nil, nil
+	}
+	return &models.ArchivedPage{URL: url, Body: []byte(body)}, nil
+}
+
+func replay(t *testing.T, client HTTPClient, url string) (*http.Response, string, error) {
+	req, err := http.NewRequest("GET", url, nil)
+	require.NoError(t, err)
+	response, err := client.Do(req)
+	if err != nil {
+		return nil, "", err
+	}
+	defer response.Body.Close()
+	body, err := io.ReadAll(response.Body)
+	require.NoError(t, err)
+	return response, string(body), nil
+}
+
+func TestReplayClient(t *testing.T) {
+	recordings := NewArchiveRecordings(archiveLookup{baseUrl + "/1": "<html>iso</html>"})
+
+	response, body, err := replay(t, NewReplayClient(recordings, false), baseUrl+"/1")
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, response.StatusCode)
+	assert.Equal(t, "<html>iso</html>", body)
+
+	response, _, err = replay(t, NewReplayClient(recordings, false), baseUrl+"/2")
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusNotFound, response.StatusCode)
+
+	_, _, err = replay(t, NewReplayClient(recordings, true), baseUrl+"/2")
+	assert.True(t, errors.Is(err, ErrNoRecording))
+}
+
+func TestWARCRecordings(t *testing.T) {
+	dir := t.TempDir()
+	writer := warc.NewFileWriter(dir, "test", 0)
+	old := warc.NewRecord(warc.TypeResponse, baseUrl+"/1", "", []byte("HTTP/1.1 200 OK\r\nContent-Length: 3\r\n\r\nold"))
+	old.Header.Set("WARC-Date", time.Now().Add(-time.Hour).UTC().Format(time.RFC3339))
+	current := warc.NewRecord(warc.TypeResponse, baseUrl+"/1", "", []byte("HTTP/1.1 200 OK\r\nContent-Length: 3\r\n\r\nnew"))
+	require.NoError(t, writer.WriteRecords(current, old))
+	require.NoError(t, writer.Close())
+
+	recordings, err := LoadWARCRecordings(dir)
+	require.NoError(t, err)
+	response, body, err := replay(t, NewReplayClient(recordings, true), baseUrl+"/1")
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, response.StatusCode)
+	assert.Equal(t, "new", body)
+}
+
+func TestParser_ParseStrictReplay(t *testing.T) {
+	parser := NewOIDParser(NewReplayClient(NewArchiveRecordings(archiveLookup{}), true), "oidscraper", nil, RetryPolicy{MaxRetries: 3})
+	items := make(chan *models.FrontierItem, 1)
+	pages := make(chan *models.Page, 1)
+	items <- &models.FrontierItem{Oid: "/1"}
+
+	err := parser.Parse(context.Background(), items, pages)
+	assert.True(t, errors.Is(err, ErrNoRecording))
+	page := <-pages
+	assert.True(t, errors.Is(page.Err, ErrNoRecording))
+}
@@ -0,0 +1,128 @@
+package scrapers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// FetchError is returned for responses that did not come back with a 2xx.
+type FetchError struct {
+	StatusCode int
+	Status     string
+	// RetryAfter is what the Retry-After header asked for, if anything.
+	RetryAfter time.Duration
+}
+
+func (e *FetchError) Error() string {
+	return fmt.Sprintf("unexpected status %v", e.Status)
+}
+
+func newFetchError(response *http.Response) *FetchError {
+	return &FetchError{
+		StatusCode: response.StatusCode,
+		Status:     response.Status,
+		RetryAfter: parseRetryAfter(response.Header.Get("Retry-After"), time.Now()),
+	}
+}
+
+// Permanent reports whether err will not go away by fetching again, so the
+// url can be marked failed straight away.
+func Permanent(err error) bool {
+	if errors.Is(err, ErrDisallowed) {
+		return true
+	}
+
+	var fetchErr *FetchError
+	if errors.As(err, &fetchErr) {
+		return fetchErr.StatusCode == http.StatusNotFound || fetchErr.StatusCode == http.StatusGone
+	}
+
+	return false
+}
+
+// RetryPolicy decides whether and when a failed fetch is tried again.
+// Throttling answers (429, 503) wait for as long as Retry-After asks, other
+// server and network errors back off exponentially with jitter. Everything
+// else is left to the frontier.
+type RetryPolicy struct {
+	// MaxRetries is how many times a fetch is retried before giving up.
+	MaxRetries int
+	// MaxAttempts is how many times a url is fetched in all, retries and
+	// earlier leases included, 0 for no limit besides MaxRetries.
+	MaxAttempts int
+	// BaseDelay is the backoff before the first retry, doubled for every
+	// retry after it.
+	BaseDelay time.Duration
+	// MaxDelay caps both the backoff and Retry-After.
+	MaxDelay time.Duration
+}
+
+// Next returns how long to wait before retry number attempt+1 of a fetch
+// that failed with err, and false if it should not be retried at all.
+func (r RetryPolicy) Next(attempt int, err error) (time.Duration, bool) {
+	if attempt >= r.MaxRetries || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) ||
+		errors.Is(err, ErrNoRecording) {
+		return 0, false
+	}
+
+	var fetchErr *FetchError
+	if errors.As(err, &fetchErr) {
+		switch {
+		case fetchErr.StatusCode == http.StatusTooManyRequests || fetchErr.StatusCode == http.StatusServiceUnavailable:
+			if fetchErr.RetryAfter > 0 {
+				return r.cap(fetchErr.RetryAfter), true
+			}
+		case fetchErr.StatusCode == http.StatusRequestTimeout || fetchErr.StatusCode >= 500:
+		default:
+			return 0, false
+		}
+	}
+
+	return r.backoff(attempt), true
+}
+
+// backoff doubles BaseDelay for every attempt and picks a random delay in
+// the upper half of it.
+func (r RetryPolicy) backoff(attempt int) time.Duration {
+	delay := r.BaseDelay
+	for i := 0; i < attempt && (r.MaxDelay <= 0 || delay < r.MaxDelay) && delay <= math.MaxInt64/2; i++ {
+		delay *= 2
+	}
+	delay = r.cap(delay)
+	if delay < 2 {
+		return delay
+	}
+
+	return delay/2 + time.Duration(rand.Int63n(int64(delay/2)))
+}
+
+func (r RetryPolicy) cap(delay time.Duration) time.Duration {
+	if r.MaxDelay > 0 && delay > r.MaxDelay {
+		return r.MaxDelay
+	}
+	return delay
+}
+
+// parseRetryAfter understands both the delay-seconds and the HTTP-date form.
+func parseRetryAfter(value string, now time.Time) time.Duration {
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		if seconds < 0 {
+			return 0
+		}
+		return time.Duration(seconds) * time.Second
+	}
+	if date, err := http.ParseTime(value); err == nil && date.After(now) {
+		return date.Sub(now)
+	}
+
+	return 0
+}
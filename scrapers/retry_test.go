@@ -0,0 +1,150 @@
+package scrapers
+
+import (
+	"context"
+	"errors"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"hello/scraper/models"
+	scrapers "hello/scraper/scrapers/mock"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRetryPolicy_Next(t *testing.T) {
+	policy := RetryPolicy{MaxRetries: 3, BaseDelay: time.Second, MaxDelay: 10 * time.Second}
+
+	tests := []struct {
+		name    string
+		attempt int
+		err     error
+		retry   bool
+		min     time.Duration
+		max     time.Duration
+	}{
+		{name: "network error", err: errors.New("connection reset"), retry: true, min: 500 * time.Millisecond, max: time.Second},
+		{name: "backoff doubles", attempt: 2, err: errors.New("connection reset"), retry: true, min: 2 * time.Second, max: 4 * time.Second},
+		{name: "retries exhausted", attempt: 3, err: errors.New("connection reset"), retry: false},
+		{name: "server error", err: &FetchError{StatusCode: 502}, retry: true, min: 500 * time.Millisecond, max: time.Second},
+		{name: "retry after", err: &FetchError{StatusCode: 429, RetryAfter: 7 * time.Second}, retry: true, min: 7 * time.Second, max: 7 * time.Second},
+		{name: "retry after is capped", err: &FetchError{StatusCode: 503, RetryAfter: time.Hour}, retry: true, min: 10 * time.Second, max: 10 * time.Second},
+		{name: "throttled without retry after", err: &FetchError{StatusCode: 429}, retry: true, min: 500 * time.Millisecond, max: time.Second},
+		{name: "not found", err: &FetchError{StatusCode: 404}, retry: false},
+		{name: "gone", err: &FetchError{StatusCode: 410}, retry: false},
+		{name: "forbidden", err: &FetchError{StatusCode: 403}, retry: false},
+		{name: "cancelled", err: context.Canceled, retry: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			delay, retry := policy.Next(tt.attempt, tt.err)
+			assert.Equal(t, tt.retry, retry)
+			if tt.retry {
+				assert.GreaterOrEqual(t, delay, tt.min)
+				assert.LessOrEqual(t, delay, tt.max)
+			}
+		})
+	}
+}
+
+func TestRetryPolicy_NextUncapped(t *testing.T) {
+	policy := RetryPolicy{MaxRetries: 100, BaseDelay: time.Second}
+
+	delay, retry := policy.Next(4, errors.New("connection reset"))
+	assert.True(t, retry)
+	assert.GreaterOrEqual(t, delay, 8*time.Second)
+	assert.LessOrEqual(t, delay, 16*time.Second)
+
+	// the doubling stops short of overflowing
+	delay, retry = policy.Next(99, errors.New("connection reset"))
+	assert.True(t, retry)
+	assert.Greater(t, delay, time.Duration(0))
+}
+
+func TestRetry_Permanent(t *testing.T) {
+	assert.True(t, Permanent(&FetchError{StatusCode: 404}))
+	assert.True(t, Permanent(&FetchError{StatusCode: 410}))
+	assert.True(t, Permanent(ErrDisallowed))
+	assert.False(t, Permanent(&FetchError{StatusCode: 503}))
+	assert.False(t, Permanent(errors.New("connection reset")))
+}
+
+func TestRetry_parseRetryAfter(t *testing.T) {
+	now := time.Date(2022, 8, 20, 12, 0, 0, 0, time.UTC)
+
+	assert.Equal(t, 120*time.Second, parseRetryAfter("120", now))
+	assert.Equal(t, 30*time.Second, parseRetryAfter("Sat, 20 Aug 2022 12:00:30 GMT", now))
+	assert.Equal(t, time.Duration(0), parseRetryAfter("Sat, 20 Aug 2022 11:00:00 GMT", now))
+	assert.Equal(t, time.Duration(0), parseRetryAfter("soon", now))
+	assert.Equal(t, time.Duration(0), parseRetryAfter("", now))
+}
+
+func TestParser_fetch(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	unavailable := func() (*http.Response, error) {
+		return &http.Response{
+			StatusCode: http.StatusServiceUnavailable,
+			Status:     "503 Service Unavailable",
+			Header:     http.Header{"Retry-After": []string{"0"}},
+			Body:       io.NopCloser(strings.NewReader("")),
+		}, nil
+	}
+	ok := func() (*http.Response, error) {
+		return &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(strings.NewReader("body"))}, nil
+	}
+
+	mockHttpClient := scrapers.NewMockHTTPClient(ctrl)
+	gomock.InOrder(
+		mockHttpClient.EXPECT().Do(gomock.Any()).Return(unavailable()),
+		mockHttpClient.EXPECT().Do(gomock.Any()).Return(nil, errors.New("connection reset")),
+		mockHttpClient.EXPECT().Do(gomock.Any()).Return(ok()),
+	)
+	parser := NewOIDParser(mockHttpClient, "oidscraper", nil, RetryPolicy{MaxRetries: 2, BaseDelay: time.Millisecond})
+
+	result, retries, err := parser.fetch(context.Background(), &models.FrontierItem{Oid: "/1"})
+	require.NoError(t, err)
+	assert.Equal(t, "body", string(result.body))
+	assert.Equal(t, 2, retries)
+}
+
+func TestParser_fetchAttempts(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockHttpClient := scrapers.NewMockHTTPClient(ctrl)
+	mockHttpClient.EXPECT().Do(gomock.Any()).Return(nil, errors.New("connection reset")).Times(2)
+	parser := NewOIDParser(mockHttpClient, "oidscraper", nil,
+		RetryPolicy{MaxRetries: 5, MaxAttempts: 3, BaseDelay: time.Millisecond})
+
+	// the url was fetched once before, so two fetches are left
+	_, retries, err := parser.fetch(context.Background(), &models.FrontierItem{Oid: "/1", Attempts: 2})
+	require.Error(t, err)
+	assert.Equal(t, 1, retries)
+}
+
+func TestParser_allowed(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	down := &RobotsError{URL: baseUrl + "/robots.txt", Err: errors.New("connection reset")}
+	mockRobots := scrapers.NewMockRobotsChecker(ctrl)
+	gomock.InOrder(
+		mockRobots.EXPECT().Allowed(gomock.Any(), baseUrl+"/1").Return(false, down),
+		mockRobots.EXPECT().Allowed(gomock.Any(), baseUrl+"/1").Return(true, nil),
+		mockRobots.EXPECT().Allowed(gomock.Any(), baseUrl+"/2").Return(false, down).Times(2),
+	)
+	parser := NewOIDParser(nil, "oidscraper", mockRobots, RetryPolicy{MaxRetries: 1, BaseDelay: time.Millisecond})
+
+	allowed, err := parser.allowed(context.Background(), "/1")
+	require.NoError(t, err)
+	assert.True(t, allowed)
+
+	_, err = parser.allowed(context.Background(), "/2")
+	assert.ErrorIs(t, err, down)
+}
@@ -0,0 +1,264 @@
+package scrapers
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const robotsTTL = 24 * time.Hour
+
+// ErrDisallowed is the page error for urls robots.txt does not let us fetch.
+var ErrDisallowed = errors.New("disallowed by robots.txt")
+
+// RobotsError is the page error for urls whose host's robots.txt could not
+// be fetched. It says nothing about the url itself, which is handed back to
+// the frontier.
+type RobotsError struct {
+	URL string
+	Err error
+}
+
+func (e *RobotsError) Error() string {
+	return fmt.Sprintf("can`t fetch %v: %v", e.URL, e.Err)
+}
+
+func (e *RobotsError) Unwrap() error {
+	return e.Err
+}
+
+// CrawlDelayer is told about the Crawl-delay a host asks for.
+type CrawlDelayer interface {
+	SetInterval(host string, interval time.Duration)
+}
+
+// Robots fetches robots.txt once per host and answers whether our user agent
+// may fetch a url. Hosts whose robots.txt asks for a Crawl-delay are slowed
+// down through the delayer.
+type Robots struct {
+	client    HTTPClient
+	userAgent string
+	delayer   CrawlDelayer
+
+	mu    sync.Mutex
+	hosts map[string]*robotsRules
+}
+
+type robotsRules struct {
+	rules      []robotsRule
+	crawlDelay time.Duration
+	fetchedAt  time.Time
+}
+
+type robotsRule struct {
+	path  string
+	allow bool
+}
+
+func NewRobots(client HTTPClient, userAgent string, delayer CrawlDelayer) *Robots {
+	return &Robots{
+		client:    client,
+		userAgent: userAgent,
+		delayer:   delayer,
+		hosts:     make(map[string]*robotsRules),
+	}
+}
+
+// Allowed reports whether rawUrl may be fetched. It fails with a
+// *RobotsError when the robots.txt of the host could not be fetched, so the
+// url can be tried again later.
+func (r *Robots) Allowed(ctx context.Context, rawUrl string) (bool, error) {
+	u, err := url.Parse(rawUrl)
+	if err != nil {
+		return false, fmt.Errorf("can`t parse url %v: %v", rawUrl, err)
+	}
+
+	rules, err := r.rulesFor(ctx, u)
+	if err != nil {
+		return false, err
+	}
+
+	return rules.allowed(u.EscapedPath()), nil
+}
+
+func (r *Robots) rulesFor(ctx context.Context, u *url.URL) (*robotsRules, error) {
+	r.mu.Lock()
+	rules, ok := r.hosts[u.Host]
+	r.mu.Unlock()
+	if ok && time.Since(rules.fetchedAt) < robotsTTL {
+		return rules, nil
+	}
+
+	rules, err := r.fetch(ctx, u.Scheme+"://"+u.Host+"/robots.txt")
+	if err != nil {
+		return nil, err
+	}
+	if rules.crawlDelay > 0 && r.delayer != nil {
+		r.delayer.SetInterval(u.Host, rules.crawlDelay)
+	}
+
+	r.mu.Lock()
+	r.hosts[u.Host] = rules
+	r.mu.Unlock()
+
+	return rules, nil
+}
+
+func (r *Robots) fetch(ctx context.Context, robotsUrl string) (*robotsRules, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", robotsUrl, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("User-Agent", r.userAgent)
+	response, err := r.client.Do(req)
+	if err != nil {
+		return nil, &RobotsError{URL: robotsUrl, Err: err}
+	}
+	defer response.Body.Close()
+
+	switch {
+	case response.StatusCode >= 500:
+		return nil, &RobotsError{URL: robotsUrl, Err: newFetchError(response)}
+	case response.StatusCode >= 400:
+		log.Printf("No robots.txt at %v (%v), everything is allowed", robotsUrl, response.Status)
+		return &robotsRules{fetchedAt: time.Now()}, nil
+	}
+
+	body, err := io.ReadAll(response.Body)
+	if err != nil {
+		return nil, &RobotsError{URL: robotsUrl, Err: err}
+	}
+
+	rules := parseRobots(body, r.userAgent)
+	log.Printf("Loaded %d robots.txt rules from %v, crawl delay %v", len(rules.rules), robotsUrl, rules.crawlDelay)
+	return rules, nil
+}
+
+// parseRobots keeps the group that names userAgent, or the * group when none
+// does.
+func parseRobots(body []byte, userAgent string) *robotsRules {
+	agent := strings.ToLower(userAgent)
+	var own, wildcard *robotsRules
+	var current []*robotsRules
+	inAgents := false
+
+	scanner := bufio.NewScanner(bytes.NewReader(body))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if i := strings.Index(line, "#"); i >= 0 {
+			line = line[:i]
+		}
+		i := strings.Index(line, ":")
+		if i < 0 {
+			continue
+		}
+		key := strings.ToLower(strings.TrimSpace(line[:i]))
+		value := strings.TrimSpace(line[i+1:])
+
+		if key == "user-agent" {
+			if !inAgents {
+				current = current[:0]
+			}
+			inAgents = true
+			name := strings.ToLower(value)
+			switch {
+			case name == "*":
+				if wildcard == nil {
+					wildcard = &robotsRules{}
+				}
+				current = append(current, wildcard)
+			case name != "" && strings.Contains(agent, name):
+				if own == nil {
+					own = &robotsRules{}
+				}
+				current = append(current, own)
+			}
+			continue
+		}
+		inAgents = false
+
+		for _, group := range current {
+			switch key {
+			case "allow", "disallow":
+				if value != "" {
+					group.rules = append(group.rules, robotsRule{path: value, allow: key == "allow"})
+				}
+			case "crawl-delay":
+				seconds, err := strconv.ParseFloat(value, 64)
+				if err == nil && seconds > 0 {
+					group.crawlDelay = time.Duration(seconds * float64(time.Second))
+				}
+			}
+		}
+	}
+
+	rules := own
+	if rules == nil {
+		rules = wildcard
+	}
+	if rules == nil {
+		rules = &robotsRules{}
+	}
+	rules.fetchedAt = time.Now()
+	return rules
+}
+
+// allowed applies the longest matching rule, Allow winning a tie.
+func (r *robotsRules) allowed(path string) bool {
+	if path == "" {
+		path = "/"
+	}
+	if path == "/robots.txt" {
+		return true
+	}
+
+	allow, longest := true, -1
+	for _, rule := range r.rules {
+		if !robotsMatch(rule.path, path) {
+			continue
+		}
+		if len(rule.path) > longest || len(rule.path) == longest && rule.allow {
+			allow, longest = rule.allow, len(rule.path)
+		}
+	}
+
+	return allow
+}
+
+// robotsMatch matches path against a robots.txt pattern that may use * for
+// any run of characters and a trailing $ to anchor the end.
+func robotsMatch(pattern, path string) bool {
+	anchored := strings.HasSuffix(pattern, "$")
+	pattern = strings.TrimSuffix(pattern, "$")
+
+	parts := strings.Split(pattern, "*")
+	if !strings.HasPrefix(path, parts[0]) {
+		return false
+	}
+	rest := path[len(parts[0]):]
+	for _, part := range parts[1:] {
+		i := strings.Index(rest, part)
+		if i < 0 {
+			return false
+		}
+		rest = rest[i+len(part):]
+	}
+
+	if anchored && rest != "" {
+		// the last part may also match later in the path
+		last := parts[len(parts)-1]
+		return len(parts) > 1 && strings.HasSuffix(path, last)
+	}
+	return true
+}
@@ -0,0 +1,163 @@
+package scrapers
+
+import (
+	"context"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	scrapers "hello/scraper/scrapers/mock"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testRobots = `# robots for tests
+User-agent: Googlebot
+Disallow: /
+
+User-agent: oidscraper
+User-agent: otherbot
+Disallow: /1.3
+Allow: /1.3.6
+Disallow: /*.pdf$
+Crawl-delay: 2.5
+
+User-agent: *
+Disallow: /orgs/
+`
+
+func TestRobots_parseRobots(t *testing.T) {
+	tests := []struct {
+		name    string
+		agent   string
+		path    string
+		allowed bool
+	}{
+		{name: "own group allows", agent: "oidscraper", path: "/1.2", allowed: true},
+		{name: "own group disallows", agent: "oidscraper", path: "/1.3.1", allowed: false},
+		{name: "longer allow wins", agent: "oidscraper", path: "/1.3.6.1", allowed: true},
+		{name: "wildcard with anchor", agent: "oidscraper", path: "/docs/a.pdf", allowed: false},
+		{name: "anchor needs the end", agent: "oidscraper", path: "/docs/a.pdf.html", allowed: true},
+		{name: "own group ignores star group", agent: "oidscraper", path: "/orgs/", allowed: true},
+		{name: "star group", agent: "somebot", path: "/orgs/1", allowed: false},
+		{name: "star group allows", agent: "somebot", path: "/1.3", allowed: true},
+		{name: "robots.txt is always allowed", agent: "googlebot", path: "/robots.txt", allowed: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rules := parseRobots([]byte(testRobots), tt.agent)
+			assert.Equal(t, tt.allowed, rules.allowed(tt.path))
+		})
+	}
+
+	assert.Equal(t, 2500*time.Millisecond, parseRobots([]byte(testRobots), "oidscraper").crawlDelay)
+}
+
+type recordingDelayer struct {
+	host     string
+	interval time.Duration
+}
+
+func (d *recordingDelayer) SetInterval(host string, interval time.Duration) {
+	d.host, d.interval = host, interval
+}
+
+func TestRobots_Allowed(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	tests := []struct {
+		name    string
+		init    func(mockHttpClient *scrapers.MockHTTPClient)
+		allowed bool
+		error   bool
+	}{
+		{
+			name: "rules",
+			init: func(mockHttpClient *scrapers.MockHTTPClient) {
+				mockHttpClient.EXPECT().Do(gomock.Any()).Return(&http.Response{
+					StatusCode: http.StatusOK,
+					Body:       io.NopCloser(strings.NewReader(testRobots)),
+				}, nil)
+			},
+			allowed: false,
+		},
+		{
+			name: "missing robots.txt",
+			init: func(mockHttpClient *scrapers.MockHTTPClient) {
+				mockHttpClient.EXPECT().Do(gomock.Any()).Return(&http.Response{
+					StatusCode: http.StatusNotFound,
+					Status:     "404 Not Found",
+					Body:       io.NopCloser(strings.NewReader("")),
+				}, nil)
+			},
+			allowed: true,
+		},
+		{
+			name: "server error",
+			init: func(mockHttpClient *scrapers.MockHTTPClient) {
+				mockHttpClient.EXPECT().Do(gomock.Any()).Return(&http.Response{
+					StatusCode: http.StatusServiceUnavailable,
+					Status:     "503 Service Unavailable",
+					Body:       io.NopCloser(strings.NewReader("")),
+				}, nil)
+			},
+			error: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockHttpClient := scrapers.NewMockHTTPClient(ctrl)
+			tt.init(mockHttpClient)
+			robots := NewRobots(mockHttpClient, "oidscraper", nil)
+
+			allowed, err := robots.Allowed(context.Background(), baseUrl+"/1.3.1")
+			if tt.error {
+				var robotsErr *RobotsError
+				assert.ErrorAs(t, err, &robotsErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.allowed, allowed)
+
+			// the rules are cached, the mock only expects one call
+			allowed, err = robots.Allowed(context.Background(), baseUrl+"/1.3.1")
+			require.NoError(t, err)
+			assert.Equal(t, tt.allowed, allowed)
+		})
+	}
+}
+
+func TestRobots_AllowedCanceled(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockHttpClient := scrapers.NewMockHTTPClient(ctrl)
+	mockHttpClient.EXPECT().Do(gomock.Any()).Return(nil, context.Canceled)
+	robots := NewRobots(mockHttpClient, "oidscraper", nil)
+
+	_, err := robots.Allowed(context.Background(), baseUrl+"/1.3.1")
+	assert.ErrorIs(t, err, context.Canceled)
+}
+
+func TestRobots_CrawlDelay(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockHttpClient := scrapers.NewMockHTTPClient(ctrl)
+	mockHttpClient.EXPECT().Do(gomock.Any()).Return(&http.Response{
+		StatusCode: http.StatusOK,
+		Body:       io.NopCloser(strings.NewReader(testRobots)),
+	}, nil)
+	delayer := &recordingDelayer{}
+	robots := NewRobots(mockHttpClient, "oidscraper", delayer)
+
+	_, err := robots.Allowed(context.Background(), baseUrl+"/1")
+	require.NoError(t, err)
+	assert.Equal(t, "oidref.com", delayer.host)
+	assert.Equal(t, 2500*time.Millisecond, delayer.interval)
+}
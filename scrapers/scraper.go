@@ -1,117 +1,519 @@
 package scrapers
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"hello/scraper/models"
 	"log"
+	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
 const (
-	baseUrl      = "https://oidref.com"
-	numDigesters = 5
-	numWalkers   = 5
+	baseUrl          = "https://oidref.com"
+	defaultDigesters = 5
+	defaultWalkers   = 5
+
+	pollInterval = time.Second
 )
 
 type Parser interface {
-	Parse(chan string, chan<- string, chan<- string) error
+	Parse(context.Context, <-chan *models.FrontierItem, chan<- *models.Page) error
 }
 
 type SqlDb interface {
-	Insert(string, *models.TableInfo) error
-	DeleteCache(string) error
-	InsertToCache(string) error
-	GetLastOidCache() (string, error)
+	Enqueue(string) error
+	Lease(time.Duration, *models.Scope) (*models.FrontierItem, error)
+	Release(string) error
+	RecoverInFlight() (int64, error)
+	AbortRuns() (int64, error)
+	Fail(string, string, int, int) error
+	Refresh(*models.Scope, *models.TTL) (int64, error)
+	SavePage(int64, *models.Page) (*models.SaveResult, error)
+	StartRun(string) (int64, error)
+	FinishRun(int64, *models.CrawlResult) error
+}
+
+// StatusReporter adds a line about itself to the periodic status output.
+type StatusReporter interface {
+	Status() string
+}
+
+// Config holds the knobs of a single crawl.
+type Config struct {
+	// Scope limits the crawl to parts of the tree. Its roots are queued
+	// before the crawl starts, so an empty frontier has somewhere to begin.
+	// A nil scope crawls everything from the root down.
+	Scope *models.Scope
+	// LeaseTimeout is how long a url may stay in flight before another
+	// walker is allowed to pick it up again.
+	LeaseTimeout time.Duration
+	// MaxAttempts is how many times a url is fetched before it is marked
+	// failed, the retries of the parser included.
+	MaxAttempts int
+	// Refresh fetches the pages crawled before again. Pages that did not
+	// change since are answered with a 304 and cost next to nothing.
+	Refresh bool
+	// Archive keeps the body of every fetched page in the page archive.
+	Archive bool
+	// TTL limits Refresh to the pages that went stale. Nil fetches every
+	// page again.
+	TTL *models.TTL
+	// Walkers and Digesters size the worker pools, five each when unset.
+	Walkers   int
+	Digesters int
+	// Adaptive resizes the pools while the crawl runs, starting from
+	// Walkers and Digesters. Nil keeps them fixed.
+	Adaptive *AdaptiveConfig
+	// StatusInterval is how often progress is logged; zero turns it off.
+	StatusInterval time.Duration
+	// Reporters are asked for their status every StatusInterval.
+	Reporters []StatusReporter
+	// Budget caps the crawl; nil runs it until the frontier is empty.
+	Budget *Budget
+	// RunConfig describes the settings of the crawl for its run record.
+	RunConfig string
 }
 
 type OIDScraper struct {
-	startUrl string
-	urlCache *sync.Map
-	db       SqlDb
-	parser   Parser
+	db     SqlDb
+	parser Parser
+	cfg    Config
+
+	// inFlight counts the urls leased but not yet saved, failed or released.
+	inFlight int64
+	// settled wakes the feeder up whenever an in-flight url is settled.
+	settled chan struct{}
+	result  *models.CrawlResult
+	// leased counts the urls handed out, for the page budget.
+	leased int64
+	// exhausted is closed once the budget is spent.
+	exhausted chan struct{}
+	exhaust   *sync.Once
+
+	walkers   *pool
+	digesters *pool
+	// the window counters feed the adaptive pools and are reset by them
+	windowPages   int64
+	windowErrors  int64
+	windowLatency int64
 }
 
-func NewOIDScraper(startUrl string, urlCache *sync.Map, db SqlDb, parser Parser) *OIDScraper {
+func NewOIDScraper(db SqlDb, parser Parser, cfg Config) *OIDScraper {
 	return &OIDScraper{
-		startUrl: startUrl,
-		urlCache: urlCache,
-		db:       db,
-		parser:   parser,
+		db:     db,
+		parser: parser,
+		cfg:    cfg,
 	}
 }
 
-func (s *OIDScraper) Start() error {
-	paths, pathsToCache, errCh := s.walk()
-	defer close(paths)
-	defer close(pathsToCache)
-	defer close(errCh)
+// Start runs the crawl until the frontier runs dry, ctx is cancelled or a
+// worker fails. On the way out it stops fetching new pages, lets the
+// digesters save the pages already handed to them and releases the urls
+// nobody got to back to the frontier.
+func (s *OIDScraper) Start(ctx context.Context) (*models.CrawlResult, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	started := time.Now()
+	s.result = &models.CrawlResult{}
+	s.settled = make(chan struct{}, 1)
+	s.exhausted = make(chan struct{})
+	s.exhaust = &sync.Once{}
+	atomic.StoreInt64(&s.inFlight, 0)
+	atomic.StoreInt64(&s.leased, 0)
+
+	recovered, err := s.db.RecoverInFlight()
+	if err != nil {
+		return nil, err
+	}
+	if recovered > 0 {
+		log.Printf("Recovered %d urls left in flight by a previous run", recovered)
+	}
+	aborted, err := s.db.AbortRuns()
+	if err != nil {
+		return nil, err
+	}
+	if aborted > 0 {
+		log.Printf("Marked %d runs a previous process never finished aborted", aborted)
+	}
+	if s.cfg.Refresh {
+		refreshed, err := s.db.Refresh(s.cfg.Scope, s.cfg.TTL)
+		if err != nil {
+			return nil, err
+		}
+		log.Printf("Refreshing %d urls crawled before", refreshed)
+	}
+	roots := []string{"/"}
+	if s.cfg.Scope != nil {
+		roots = s.cfg.Scope.Roots
+	}
+	for _, root := range roots {
+		err = s.db.Enqueue(root)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	s.result.RunID, err = s.db.StartRun(s.cfg.RunConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	walkers, digesters := s.cfg.Walkers, s.cfg.Digesters
+	if walkers <= 0 {
+		walkers = defaultWalkers
+	}
+	if digesters <= 0 {
+		digesters = defaultDigesters
+	}
+	queue := walkers
+	if s.cfg.Adaptive != nil && s.cfg.Adaptive.MaxWalkers > queue {
+		queue = s.cfg.Adaptive.MaxWalkers
+	}
+
+	items := make(chan *models.FrontierItem, queue)
+	pages := make(chan *models.Page, queue)
+	errCh := make(chan error, 1)
+	drained := make(chan struct{})
+
+	feeder := &sync.WaitGroup{}
+	feeder.Add(1)
+	go func() {
+		defer feeder.Done()
+		s.feed(ctx, items, errCh, drained)
+	}()
+
+	s.walkers = newPool(func() {
+		err := s.parser.Parse(ctx, items, pages)
+		if err != nil {
+			reportErr(errCh, err)
+		}
+	}, func() {
+		select {
+		case items <- nil:
+		case <-ctx.Done():
+		}
+	})
+	quit := make(chan struct{})
+	s.digesters = newPool(func() {
+		s.digester(pages, quit, errCh)
+	}, func() {
+		select {
+		case quit <- struct{}{}:
+		case <-ctx.Done():
+		}
+	})
+	s.walkers.resize(walkers)
+	s.digesters.resize(digesters)
 
-	for i := 0; i < numDigesters; i++ {
+	// the monitors are stopped and joined before the pools are waited on, so
+	// none of them resizes a pool that is shutting down or outlives the run
+	monitorCtx, stopMonitors := context.WithCancel(ctx)
+	defer stopMonitors()
+	monitors := &sync.WaitGroup{}
+	if s.cfg.Adaptive != nil {
+		monitors.Add(1)
 		go func() {
-			s.digesterCache(pathsToCache, errCh)
+			defer monitors.Done()
+			s.adapt(monitorCtx, pages)
 		}()
+	}
+	if s.cfg.StatusInterval > 0 {
+		monitors.Add(1)
 		go func() {
-			s.digester(paths, errCh)
+			defer monitors.Done()
+			s.reportStatus(monitorCtx, started)
 		}()
 	}
+	var deadline <-chan time.Time
+	if s.cfg.Budget != nil && s.cfg.Budget.MaxDuration > 0 {
+		timer := time.NewTimer(s.cfg.Budget.MaxDuration)
+		defer timer.Stop()
+		deadline = timer.C
+	}
 
 	select {
-	case err := <-errCh:
-		return err
+	case <-drained:
+		log.Printf("Frontier is empty, shutting down")
+		s.result.ExitReason = models.ExitCompleted
+	case <-s.exhausted:
+		s.result.ExitReason = models.ExitBudget
+	case <-deadline:
+		log.Printf("Shutting down: out of time after %v", s.cfg.Budget.MaxDuration)
+		s.result.ExitReason = models.ExitBudget
+	case <-ctx.Done():
+		log.Printf("Shutting down: %v", ctx.Err())
+		s.result.ExitReason = models.ExitInterrupted
+	case err = <-errCh:
+		log.Printf("Shutting down after error: %v", err)
+		s.result.ExitReason = models.ExitError
+	}
+	stopMonitors()
+	monitors.Wait()
+	cancel()
+
+	feeder.Wait()
+	s.walkers.wait()
+	close(pages)
+	s.digesters.wait()
+	s.release(items)
+
+	result := s.result
+	result.Duration = time.Since(started)
+	log.Printf("Run %d stopped after %v (%v): %d pages fetched, %d unchanged, %d bytes, %d records inserted, "+
+		"%d updated, %d tombstoned, %d failures, %d urls released", result.RunID, result.Duration.Round(time.Second),
+		result.ExitReason, result.PagesFetched, result.PagesUnchanged, result.BytesFetched, result.RecordsInserted,
+		result.RecordsUpdated, result.RecordsTombstoned, result.Failures, result.Released)
+
+	finishErr := s.db.FinishRun(result.RunID, result)
+	if err == nil {
+		err = finishErr
 	}
+	return result, err
 }
 
-func (s *OIDScraper) walk() (chan string, chan string, chan error) {
-	paths := make(chan string)
-	pathsToCache := make(chan string)
-	errCh := make(chan error, 1)
-	urlCh := make(chan string, numWalkers)
+// reportStatus logs the progress of the crawl every StatusInterval until ctx
+// is done.
+func (s *OIDScraper) reportStatus(ctx context.Context, started time.Time) {
+	ticker := time.NewTicker(s.cfg.StatusInterval)
+	defer ticker.Stop()
 
-	for i := 0; i < numWalkers; i++ {
-		go func(urlCh chan string) {
-			err := s.parser.Parse(urlCh, paths, pathsToCache)
-			if err != nil {
-				close(urlCh)
-				errCh <- err
-			}
-		}(urlCh)
-	}
-	go func(urlCh chan string) {
-		for {
-			restartUrl, err := s.db.GetLastOidCache()
-			if err != nil && err.Error() != "cant find last added oid: sql: no rows in result set" {
-				errCh <- err
-				close(urlCh)
-			}
-			urlCh <- restartUrl
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
 		}
-	}(urlCh)
 
-	return paths, pathsToCache, errCh
+		status := fmt.Sprintf("Status after %v: %d pages fetched, %d records inserted, %d failures, %d urls in flight, "+
+			"%d walkers, %d digesters", time.Since(started).Round(time.Second), atomic.LoadInt64(&s.result.PagesFetched),
+			atomic.LoadInt64(&s.result.RecordsInserted), atomic.LoadInt64(&s.result.Failures),
+			atomic.LoadInt64(&s.inFlight), s.walkers.len(), s.digesters.len())
+		for _, reporter := range s.cfg.Reporters {
+			status += "; " + reporter.Status()
+		}
+		log.Println(status)
+	}
 }
 
-func (s *OIDScraper) digester(paths <-chan string, errCh chan<- error) {
-	for path := range paths {
-		err := s.db.DeleteCache(path)
+// feed leases urls from the frontier and hands them to the walkers. When the
+// frontier has nothing pending it waits for an in-flight url to settle or
+// pollInterval to pass before checking again, and once
+// nothing is pending and nothing is in flight either it closes drained.
+func (s *OIDScraper) feed(ctx context.Context, items chan<- *models.FrontierItem, errCh chan<- error, drained chan<- struct{}) {
+	for ctx.Err() == nil {
+		// Only digesters add to the frontier and they are done with every
+		// url counted here, so an idle check taken before the lease cannot
+		// miss links that are still on their way.
+		idle := atomic.LoadInt64(&s.inFlight) == 0
+		if !s.cfg.Budget.pagesLeft(atomic.LoadInt64(&s.leased)) {
+			if idle {
+				s.spend(fmt.Sprintf("%d pages handed out", atomic.LoadInt64(&s.leased)))
+				return
+			}
+			select {
+			case <-s.settled:
+			case <-ctx.Done():
+			}
+			continue
+		}
+		item, err := s.db.Lease(s.cfg.LeaseTimeout, s.cfg.Scope)
 		if err != nil {
-			errCh <- err
+			reportErr(errCh, err)
+			return
+		}
+		if item == nil {
+			if idle {
+				close(drained)
+				return
+			}
+			select {
+			case <-s.settled:
+			case <-time.After(pollInterval):
+			case <-ctx.Done():
+			}
+			continue
+		}
+
+		atomic.AddInt64(&s.inFlight, 1)
+		atomic.AddInt64(&s.leased, 1)
+		select {
+		case items <- item:
+		case <-ctx.Done():
+			s.releaseUrl(item.Oid)
+			return
 		}
-		if v, ok := s.urlCache.Load(path); ok {
-			err = s.db.Insert(path, v.(*models.TableInfo))
+	}
+}
+
+// digester saves pages until pages is closed or it is told to quit.
+func (s *OIDScraper) digester(pages <-chan *models.Page, quit <-chan struct{}, errCh chan<- error) {
+	for {
+		select {
+		case page, ok := <-pages:
+			if !ok {
+				return
+			}
+			err := s.digest(page)
 			if err != nil {
-				errCh <- err
+				reportErr(errCh, err)
 			}
-			log.Println("Added to database info from link ", path)
-		} else {
-			log.Println("No info found for url ", path)
+		case <-quit:
+			return
 		}
 	}
 }
 
-func (s *OIDScraper) digesterCache(paths <-chan string, errCh chan<- error) {
-	for path := range paths {
-		err := s.db.InsertToCache(path)
+func (s *OIDScraper) digest(page *models.Page) error {
+	defer s.settle()
+	s.observe(page)
+
+	switch {
+	case page.Err == nil:
+		atomic.AddInt64(&s.result.BytesFetched, int64(len(page.Body)))
+		scopePage(s.cfg.Scope, page)
+		if !s.cfg.Archive {
+			page.Body = nil
+		}
+		saved, err := s.db.SavePage(s.result.RunID, page)
+		if err != nil {
+			return err
+		}
+		if page.Unchanged {
+			atomic.AddInt64(&s.result.PagesUnchanged, 1)
+			log.Printf("Link %v did not change", page.Oid)
+			return nil
+		}
+		atomic.AddInt64(&s.result.PagesFetched, 1)
+		atomic.AddInt64(&s.result.RecordsInserted, int64(len(saved.Inserted)))
+		atomic.AddInt64(&s.result.RecordsUpdated, int64(len(saved.Updated)))
+		atomic.AddInt64(&s.result.RecordsTombstoned, int64(len(saved.Tombstoned)))
+		log.Printf("Saved %d new and %d changed records from link %v", len(saved.Inserted), len(saved.Updated), page.Oid)
+		if len(saved.Tombstoned) > 0 {
+			log.Printf("Link %v no longer lists %v", page.Oid, strings.Join(saved.Tombstoned, ", "))
+		}
+		if len(saved.Unlisted) > 0 {
+			log.Printf("Link %v did not list %v, siblings of %v", models.Parent(page.Oid),
+				strings.Join(saved.Unlisted, ", "), page.Oid)
+		}
+		if reason := s.cfg.Budget.spent(s.result); reason != "" {
+			s.spend(reason)
+		}
+	case Permanent(page.Err):
+		err := s.db.Fail(page.Oid, page.Err.Error(), page.Retries, 0)
 		if err != nil {
-			errCh <- err
+			return err
+		}
+		atomic.AddInt64(&s.result.Failures, 1)
+		log.Printf("Gave up on link %v: %v", page.Oid, page.Err)
+	case errors.Is(page.Err, context.Canceled) || errors.Is(page.Err, context.DeadlineExceeded) ||
+		errors.Is(page.Err, ErrNoRecording) || errors.As(page.Err, new(*RobotsError)):
+		err := s.db.Release(page.Oid)
+		if err != nil {
+			return err
+		}
+		atomic.AddInt64(&s.result.Released, 1)
+	default:
+		err := s.db.Fail(page.Oid, page.Err.Error(), page.Retries, s.cfg.MaxAttempts)
+		if err != nil {
+			return err
+		}
+		atomic.AddInt64(&s.result.Failures, 1)
+		log.Printf("Couldn`t crawl link %v: %v", page.Oid, page.Err)
+	}
+
+	return nil
+}
+
+// observe adds a fetch to the window the adaptive pools look at.
+func (s *OIDScraper) observe(page *models.Page) {
+	if errors.Is(page.Err, context.Canceled) || errors.Is(page.Err, context.DeadlineExceeded) {
+		return
+	}
+	atomic.AddInt64(&s.windowPages, 1)
+	atomic.AddInt64(&s.windowLatency, int64(page.Elapsed))
+	if page.Err != nil && !Permanent(page.Err) {
+		atomic.AddInt64(&s.windowErrors, 1)
+	}
+}
+
+// scopePage drops the links, siblings and records of page that fall outside
+// scope.
+func scopePage(scope *models.Scope, page *models.Page) {
+	if scope == nil {
+		return
+	}
+
+	page.Links = follow(scope, page.Links)
+	page.Siblings = follow(scope, page.Siblings)
+
+	for oid := range page.Records {
+		if !scope.Contains(oid) {
+			delete(page.Records, oid)
+		}
+	}
+}
+
+func follow(scope *models.Scope, oids []string) []string {
+	followed := oids[:0]
+	for _, oid := range oids {
+		if scope.Follow(oid) {
+			followed = append(followed, oid)
 		}
 	}
+	return followed
+}
+
+// release hands the urls the walkers never picked up back to the frontier.
+func (s *OIDScraper) release(items chan *models.FrontierItem) {
+	for {
+		select {
+		case item := <-items:
+			if item != nil {
+				s.releaseUrl(item.Oid)
+			}
+		default:
+			return
+		}
+	}
+}
+
+func (s *OIDScraper) releaseUrl(url string) {
+	defer s.settle()
+
+	err := s.db.Release(url)
+	if err != nil {
+		log.Printf("Couldn`t release url %v: %v", url, err)
+		return
+	}
+	atomic.AddInt64(&s.result.Released, 1)
+}
+
+// spend stops the crawl because its budget ran out.
+func (s *OIDScraper) spend(reason string) {
+	s.exhaust.Do(func() {
+		log.Printf("Shutting down: budget spent, %v", reason)
+		close(s.exhausted)
+	})
+}
+
+func (s *OIDScraper) settle() {
+	atomic.AddInt64(&s.inFlight, -1)
+	select {
+	case s.settled <- struct{}{}:
+	default:
+	}
+}
+
+// reportErr hands err to whoever is waiting on errCh. Only the first error
+// stops the scraper, the rest are logged so that no worker blocks on shutdown.
+func reportErr(errCh chan<- error, err error) {
+	select {
+	case errCh <- err:
+	default:
+		log.Printf("Error during shutdown: %v", err)
+	}
 }
@@ -0,0 +1,370 @@
+package scrapers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"hello/scraper/models"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// memDb is an in-memory frontier good enough to drive the scraper in tests.
+type memDb struct {
+	mu      sync.Mutex
+	order   []string
+	states  map[string]string
+	records map[string]*models.TableInfo
+}
+
+func newMemDb() *memDb {
+	return &memDb{states: map[string]string{}, records: map[string]*models.TableInfo{}}
+}
+
+func (m *memDb) Enqueue(oid string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.enqueue(oid)
+	return nil
+}
+
+func (m *memDb) enqueue(oid string) {
+	if _, ok := m.states[oid]; !ok {
+		m.states[oid] = models.StatePending
+		m.order = append(m.order, oid)
+	}
+}
+
+func (m *memDb) Lease(_ time.Duration, scope *models.Scope) (*models.FrontierItem, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, oid := range m.order {
+		if m.states[oid] == models.StatePending && scope.Follow(oid) {
+			m.states[oid] = models.StateInFlight
+			return &models.FrontierItem{Oid: oid, Attempts: 1}, nil
+		}
+	}
+	return nil, nil
+}
+
+func (m *memDb) Release(oid string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.states[oid] = models.StatePending
+	return nil
+}
+
+func (m *memDb) RecoverInFlight() (int64, error) {
+	return 0, nil
+}
+
+func (m *memDb) AbortRuns() (int64, error) {
+	return 0, nil
+}
+
+func (m *memDb) Fail(oid string, _ string, _ int, _ int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.states[oid] = models.StateFailed
+	return nil
+}
+
+func (m *memDb) StartRun(string) (int64, error) {
+	return 1, nil
+}
+
+func (m *memDb) FinishRun(int64, *models.CrawlResult) error {
+	return nil
+}
+
+func (m *memDb) Refresh(*models.Scope, *models.TTL) (int64, error) {
+	return 0, nil
+}
+
+func (m *memDb) SavePage(_ int64, page *models.Page) (*models.SaveResult, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	result := &models.SaveResult{}
+	for oid, info := range page.Records {
+		if _, ok := m.records[oid]; !ok {
+			result.Inserted = append(result.Inserted, oid)
+		}
+		m.records[oid] = info
+	}
+	for _, oid := range page.Links {
+		m.enqueue(oid)
+	}
+	m.states[page.Oid] = models.StateDone
+	return result, nil
+}
+
+// treeParser serves pages out of a map of parent to children, taking delay
+// for every page.
+type treeParser struct {
+	tree  map[string][]string
+	delay time.Duration
+	// running and peak count the walkers in Parse
+	running int64
+	peak    int64
+}
+
+func (p *treeParser) Parse(ctx context.Context, items <-chan *models.FrontierItem, pages chan<- *models.Page) error {
+	running := atomic.AddInt64(&p.running, 1)
+	defer atomic.AddInt64(&p.running, -1)
+	for peak := atomic.LoadInt64(&p.peak); running > peak; peak = atomic.LoadInt64(&p.peak) {
+		if atomic.CompareAndSwapInt64(&p.peak, peak, running) {
+			break
+		}
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case item := <-items:
+			if item == nil {
+				return nil
+			}
+			time.Sleep(p.delay)
+			page := &models.Page{Oid: item.Oid, Records: map[string]*models.TableInfo{}}
+			for _, child := range p.tree[item.Oid] {
+				page.Links = append(page.Links, child)
+				page.Records[child] = &models.TableInfo{Name: child}
+			}
+			pages <- page
+		}
+	}
+}
+
+func TestScraper_StartCompletes(t *testing.T) {
+	db := newMemDb()
+	parser := &treeParser{tree: map[string][]string{
+		"/":      {"/0", "/1", "/2"},
+		"/1":     {"/1.0", "/1.3"},
+		"/1.3":   {"/1.3.6"},
+		"/1.3.6": {"/1.3.6.1"},
+	}}
+	scraper := NewOIDScraper(db, parser, Config{LeaseTimeout: time.Minute, MaxAttempts: 1})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	result, err := scraper.Start(ctx)
+	require.NoError(t, err)
+
+	assert.Equal(t, models.ExitCompleted, result.ExitReason)
+	assert.Equal(t, int64(8), result.PagesFetched)
+	assert.Equal(t, int64(7), result.RecordsInserted)
+	for oid, state := range db.states {
+		assert.Equal(t, models.StateDone, state, oid)
+	}
+}
+
+func TestScraper_StartScoped(t *testing.T) {
+	db := newMemDb()
+	parser := &treeParser{tree: map[string][]string{
+		"/1.3":       {"/1.3.6", "/1.3.7"},
+		"/1.3.6":     {"/1.3.6.1", "/1.3.6.2"},
+		"/1.3.6.1":   {"/1.3.6.1.2", "/1.3.6.1.4"},
+		"/1.3.6.1.4": {"/1.3.6.1.4.1"},
+		"/1.3.6.2":   {"/1.3.6.2.1"},
+	}}
+	scope := models.NewScope([]string{"1.3"}, 3, []string{"1.3.6.2"})
+	scraper := NewOIDScraper(db, parser, Config{Scope: scope, LeaseTimeout: time.Minute, MaxAttempts: 1})
+
+	result, err := scraper.Start(context.Background())
+	require.NoError(t, err)
+
+	assert.Equal(t, models.ExitCompleted, result.ExitReason)
+	assert.ElementsMatch(t, []string{"/1.3", "/1.3.6", "/1.3.7", "/1.3.6.1"}, db.order)
+	assert.Len(t, db.records, 5)
+	assert.NotContains(t, db.records, "/1.3.6.2")
+}
+
+func TestScraper_StartAdaptive(t *testing.T) {
+	db := newMemDb()
+	tree := map[string][]string{}
+	for i := 0; i < 50; i++ {
+		tree["/"] = append(tree["/"], fmt.Sprintf("/%d", i))
+	}
+	parser := &treeParser{tree: tree, delay: 2 * time.Millisecond}
+	scraper := NewOIDScraper(db, parser, Config{
+		LeaseTimeout: time.Minute,
+		MaxAttempts:  1,
+		Walkers:      1,
+		Digesters:    1,
+		Adaptive: &AdaptiveConfig{
+			MinWalkers:   1,
+			MaxWalkers:   4,
+			MinDigesters: 1,
+			MaxDigesters: 2,
+			Interval:     5 * time.Millisecond,
+		},
+	})
+
+	result, err := scraper.Start(context.Background())
+	require.NoError(t, err)
+
+	assert.Equal(t, int64(51), result.PagesFetched)
+	assert.Greater(t, atomic.LoadInt64(&parser.peak), int64(1))
+	assert.LessOrEqual(t, atomic.LoadInt64(&parser.peak), int64(4))
+	// every walker returned on its own once the crawl was done
+	assert.Equal(t, 0, scraper.walkers.len())
+	assert.Equal(t, 0, scraper.digesters.len())
+}
+
+func TestPool_resize(t *testing.T) {
+	stop := make(chan struct{})
+	var running int64
+	p := newPool(func() {
+		atomic.AddInt64(&running, 1)
+		<-stop
+		atomic.AddInt64(&running, -1)
+	}, func() {
+		stop <- struct{}{}
+	})
+
+	p.resize(4)
+	assert.Equal(t, 4, p.len())
+	p.resize(1)
+	assert.Equal(t, 1, p.len())
+	assert.Eventually(t, func() bool { return atomic.LoadInt64(&running) == 1 }, time.Second, time.Millisecond)
+
+	close(stop)
+	p.wait()
+	assert.Equal(t, 0, p.len())
+}
+
+func TestPool_workerReturns(t *testing.T) {
+	quit := make(chan struct{})
+	p := newPool(func() {
+		<-quit
+	}, func() {})
+
+	p.resize(3)
+	close(quit)
+	p.wait()
+	assert.Equal(t, 0, p.len())
+
+	// a worker stopped and one returning on its own are told apart
+	stop := make(chan struct{})
+	p = newPool(func() { <-stop }, func() { stop <- struct{}{} })
+	p.resize(2)
+	p.resize(1)
+	assert.Eventually(t, func() bool { return p.len() == 1 }, time.Second, time.Millisecond)
+	stop <- struct{}{}
+	p.wait()
+	assert.Equal(t, 0, p.len())
+}
+
+func TestScraper_StartInterrupted(t *testing.T) {
+	db := newMemDb()
+	scraper := NewOIDScraper(db, &blockingParser{}, Config{LeaseTimeout: time.Minute, MaxAttempts: 1})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	result, err := scraper.Start(ctx)
+	require.NoError(t, err)
+
+	assert.Equal(t, models.ExitInterrupted, result.ExitReason)
+	assert.Equal(t, models.StatePending, db.states["/"])
+}
+
+func TestScraper_StartRobotsDown(t *testing.T) {
+	db := newMemDb()
+	parser := &robotsDownParser{down: 2}
+	scraper := NewOIDScraper(db, parser, Config{LeaseTimeout: time.Minute, MaxAttempts: 1})
+
+	result, err := scraper.Start(context.Background())
+	require.NoError(t, err)
+
+	assert.Equal(t, models.ExitCompleted, result.ExitReason)
+	assert.Equal(t, int64(2), result.Released)
+	assert.Zero(t, result.Failures)
+	assert.Equal(t, models.StateDone, db.states["/"])
+}
+
+// robotsDownParser cannot fetch robots.txt for the first down pages it is
+// handed and serves empty pages after that.
+type robotsDownParser struct {
+	down int
+}
+
+func (p *robotsDownParser) Parse(ctx context.Context, items <-chan *models.FrontierItem, pages chan<- *models.Page) error {
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case item := <-items:
+			if item == nil {
+				return nil
+			}
+			if p.down > 0 {
+				p.down--
+				pages <- &models.Page{Oid: item.Oid, Err: &RobotsError{URL: baseUrl + "/robots.txt", Err: errors.New("connection reset")}}
+				continue
+			}
+			pages <- &models.Page{Oid: item.Oid, Records: map[string]*models.TableInfo{}}
+		}
+	}
+}
+
+// blockingParser never gets to the pages it is handed.
+type blockingParser struct{}
+
+func (p *blockingParser) Parse(ctx context.Context, _ <-chan *models.FrontierItem, _ chan<- *models.Page) error {
+	<-ctx.Done()
+	return nil
+}
+
+func TestScraper_StartBudget(t *testing.T) {
+	tree := map[string][]string{}
+	for i := 0; i < 20; i++ {
+		tree["/"] = append(tree["/"], fmt.Sprintf("/%d", i))
+		tree[fmt.Sprintf("/%d", i)] = []string{fmt.Sprintf("/%d.1", i)}
+	}
+
+	tests := []struct {
+		name   string
+		budget *Budget
+		check  func(t *testing.T, result *models.CrawlResult)
+	}{
+		{name: "pages", budget: &Budget{MaxPages: 5}, check: func(t *testing.T, result *models.CrawlResult) {
+			assert.Equal(t, int64(5), result.PagesFetched)
+		}},
+		{name: "new records", budget: &Budget{MaxNewRecords: 25}, check: func(t *testing.T, result *models.CrawlResult) {
+			assert.GreaterOrEqual(t, result.RecordsInserted, int64(25))
+			assert.Less(t, result.RecordsInserted, int64(40))
+		}},
+		{name: "duration", budget: &Budget{MaxDuration: 30 * time.Millisecond},
+			check: func(t *testing.T, result *models.CrawlResult) {
+				assert.Less(t, result.PagesFetched, int64(41))
+			}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := newMemDb()
+			parser := &treeParser{tree: tree, delay: 5 * time.Millisecond}
+			scraper := NewOIDScraper(db, parser, Config{LeaseTimeout: time.Minute, MaxAttempts: 1, Walkers: 2,
+				Budget: tt.budget})
+
+			result, err := scraper.Start(context.Background())
+			require.NoError(t, err)
+
+			assert.Equal(t, models.ExitBudget, result.ExitReason)
+			tt.check(t, result)
+			pending := 0
+			for _, state := range db.states {
+				assert.NotEqual(t, models.StateInFlight, state)
+				if state == models.StatePending {
+					pending++
+				}
+			}
+			assert.Greater(t, pending, 0)
+		})
+	}
+}
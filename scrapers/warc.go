@@ -0,0 +1,139 @@
+package scrapers
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"hello/scraper/models"
+	"hello/scraper/warc"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httputil"
+	"strings"
+)
+
+// WARCRecorder stores WARC records, e.g. a warc.FileWriter.
+type WARCRecorder interface {
+	WriteRecords(...*warc.Record) error
+}
+
+// RecordingClient writes a request and a response record for every exchange
+// made through it. A response it cannot record is still handed back, the
+// failure is only logged.
+type RecordingClient struct {
+	client   HTTPClient
+	recorder WARCRecorder
+}
+
+func NewRecordingClient(client HTTPClient, recorder WARCRecorder) *RecordingClient {
+	return &RecordingClient{
+		client:   client,
+		recorder: recorder,
+	}
+}
+
+func (c *RecordingClient) Do(req *http.Request) (*http.Response, error) {
+	response, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	reqDump, err := httputil.DumpRequest(req, false)
+	if err != nil {
+		log.Printf("Couldn`t record request to %v: %v", req.URL, err)
+		return response, nil
+	}
+	// reads the body and puts an in-memory copy back
+	respDump, err := httputil.DumpResponse(response, true)
+	if err != nil {
+		response.Body.Close()
+		return nil, fmt.Errorf("cant read response of %v: %v", req.URL, err)
+	}
+
+	uri := req.URL.String()
+	request := warc.NewRecord(warc.TypeRequest, uri, "application/http;msgtype=request", reqDump)
+	record := warc.NewRecord(warc.TypeResponse, uri, "application/http;msgtype=response", respDump)
+	request.Header.Set("WARC-Concurrent-To", record.Header.Get("WARC-Record-ID"))
+	request.Header.Set("WARC-Date", record.Header.Get("WARC-Date"))
+	err = c.recorder.WriteRecords(request, record)
+	if err != nil {
+		log.Printf("Couldn`t record response of %v: %v", req.URL, err)
+	}
+
+	return response, nil
+}
+
+// PageImporter adds fetches made elsewhere to the page archive.
+type PageImporter interface {
+	ImportPage(*models.ArchivedPage) (bool, error)
+}
+
+// ImportWARC adds the successful responses for oid pages found in the WARC
+// file r to the archive. It returns how many pages it added and how many it
+// skipped, because they were no oid pages, no successful responses or
+// already archived.
+func ImportWARC(db PageImporter, r io.Reader) (int, int, error) {
+	reader, err := warc.NewReader(r)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	imported, skipped := 0, 0
+	for {
+		record, err := reader.ReadRecord()
+		if err == io.EOF {
+			return imported, skipped, nil
+		}
+		if err != nil {
+			return imported, skipped, err
+		}
+		if record.Type() != warc.TypeResponse {
+			continue
+		}
+
+		page, ok := pageOf(record)
+		if !ok {
+			skipped++
+			continue
+		}
+		added, err := db.ImportPage(page)
+		if err != nil {
+			return imported, skipped, err
+		}
+		if added {
+			imported++
+		} else {
+			skipped++
+		}
+	}
+}
+
+// pageOf reads the oid page out of a response record, if it holds one.
+func pageOf(record *warc.Record) (*models.ArchivedPage, bool) {
+	uri := strings.Trim(record.TargetURI(), "<>")
+	if !strings.HasPrefix(uri, baseUrl+"/") {
+		return nil, false
+	}
+	oid := strings.TrimPrefix(uri, baseUrl)
+	if !isOidPath(oid) {
+		return nil, false
+	}
+
+	response, err := http.ReadResponse(bufio.NewReader(bytes.NewReader(record.Block)), nil)
+	if err != nil {
+		log.Printf("Couldn`t read recorded response of %v: %v", uri, err)
+		return nil, false
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return nil, false
+	}
+	body, err := io.ReadAll(response.Body)
+	if err != nil {
+		log.Printf("Couldn`t read recorded response of %v: %v", uri, err)
+		return nil, false
+	}
+
+	return &models.ArchivedPage{Oid: oid, URL: uri, FetchedAt: record.Date(), Body: body}, true
+}
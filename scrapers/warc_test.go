@@ -0,0 +1,105 @@
+package scrapers
+
+import (
+	"bytes"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"hello/scraper/models"
+	"hello/scraper/warc"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+type bufferRecorder struct {
+	w *warc.Writer
+}
+
+func (b *bufferRecorder) WriteRecords(records ...*warc.Record) error {
+	for _, record := range records {
+		_, err := b.w.WriteRecord(record)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type pageImporter struct {
+	pages []*models.ArchivedPage
+}
+
+func (p *pageImporter) ImportPage(page *models.ArchivedPage) (bool, error) {
+	for _, known := range p.pages {
+		if known.URL == page.URL && known.FetchedAt.Equal(page.FetchedAt) && bytes.Equal(known.Body, page.Body) {
+			return false, nil
+		}
+	}
+	p.pages = append(p.pages, page)
+	return true, nil
+}
+
+func TestRecordingClient_ImportWARC(t *testing.T) {
+	responses := map[string]*http.Response{
+		"/1.3":        {StatusCode: http.StatusOK, Body: io.NopCloser(strings.NewReader("<html>1.3</html>"))},
+		"/robots.txt": {StatusCode: http.StatusOK, Body: io.NopCloser(strings.NewReader("User-agent: *"))},
+		"/1.4":        {StatusCode: http.StatusNotFound, Body: io.NopCloser(strings.NewReader("not found"))},
+	}
+	client := httpClientFunc(func(req *http.Request) (*http.Response, error) {
+		response := responses[req.URL.Path]
+		response.Proto, response.ProtoMajor, response.ProtoMinor = "HTTP/1.1", 1, 1
+		response.Header = http.Header{"Content-Type": {"text/html"}}
+		response.Request = req
+		return response, nil
+	})
+	var buf bytes.Buffer
+	recording := NewRecordingClient(client, &bufferRecorder{w: warc.NewWriter(&buf, true)})
+
+	for _, path := range []string{"/1.3", "/robots.txt", "/1.4"} {
+		req, err := http.NewRequest("GET", baseUrl+path, nil)
+		require.NoError(t, err)
+		response, err := recording.Do(req)
+		require.NoError(t, err)
+		body, err := io.ReadAll(response.Body)
+		require.NoError(t, err)
+		assert.NotEmpty(t, body)
+	}
+
+	importer := &pageImporter{}
+	recorded := buf.Bytes()
+	imported, skipped, err := ImportWARC(importer, bytes.NewReader(recorded))
+	require.NoError(t, err)
+	assert.Equal(t, 1, imported)
+	assert.Equal(t, 2, skipped)
+	require.Len(t, importer.pages, 1)
+	assert.Equal(t, "/1.3", importer.pages[0].Oid)
+	assert.Equal(t, baseUrl+"/1.3", importer.pages[0].URL)
+	assert.Equal(t, "<html>1.3</html>", string(importer.pages[0].Body))
+	assert.False(t, importer.pages[0].FetchedAt.IsZero())
+
+	imported, skipped, err = ImportWARC(importer, bytes.NewReader(recorded))
+	require.NoError(t, err)
+	assert.Equal(t, 0, imported)
+	assert.Equal(t, 3, skipped)
+}
+
+func TestRecordingClient_DoUnreadable(t *testing.T) {
+	closed := false
+	client := httpClientFunc(func(req *http.Request) (*http.Response, error) {
+		body := &closeHook{Reader: iotest.ErrReader(errors.New("connection reset")), close: func() { closed = true }}
+		return &http.Response{StatusCode: http.StatusOK, ProtoMajor: 1, ProtoMinor: 1, Body: body, Request: req}, nil
+	})
+	var buf bytes.Buffer
+	recording := NewRecordingClient(client, &bufferRecorder{w: warc.NewWriter(&buf, true)})
+
+	req, err := http.NewRequest("GET", baseUrl+"/1.3", nil)
+	require.NoError(t, err)
+	response, err := recording.Do(req)
+	require.Error(t, err)
+	assert.Nil(t, response)
+	assert.True(t, closed)
+	assert.Zero(t, buf.Len())
+}
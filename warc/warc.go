@@ -0,0 +1,293 @@
+package warc
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const version = "WARC/1.1"
+
+// Record types used by the crawler.
+const (
+	TypeWarcinfo = "warcinfo"
+	TypeRequest  = "request"
+	TypeResponse = "response"
+)
+
+// Record is a single WARC record. Header holds the named fields, Block the
+// content; Content-Length is filled in on write.
+type Record struct {
+	Header textproto.MIMEHeader
+	Block  []byte
+}
+
+// NewRecord creates a record of type typ with a fresh id, dated now.
+func NewRecord(typ, targetURI, contentType string, block []byte) *Record {
+	header := textproto.MIMEHeader{}
+	header.Set("WARC-Type", typ)
+	header.Set("WARC-Record-ID", NewRecordID())
+	header.Set("WARC-Date", time.Now().UTC().Format(time.RFC3339))
+	if targetURI != "" {
+		header.Set("WARC-Target-URI", targetURI)
+	}
+	if contentType != "" {
+		header.Set("Content-Type", contentType)
+	}
+
+	return &Record{Header: header, Block: block}
+}
+
+// NewRecordID returns a random urn:uuid record id.
+func NewRecordID() string {
+	var b [16]byte
+	_, _ = rand.Read(b[:])
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("<urn:uuid:%x-%x-%x-%x-%x>", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
+
+func (r *Record) Type() string {
+	return r.Header.Get("WARC-Type")
+}
+
+func (r *Record) TargetURI() string {
+	return r.Header.Get("WARC-Target-URI")
+}
+
+// Date is the WARC-Date of the record, the zero time when it is missing.
+func (r *Record) Date() time.Time {
+	date, _ := time.Parse(time.RFC3339Nano, r.Header.Get("WARC-Date"))
+	return date
+}
+
+// Writer writes records to w, each one in a gzip member of its own when
+// compressed, as tools reading .warc.gz files expect.
+type Writer struct {
+	w        io.Writer
+	compress bool
+}
+
+func NewWriter(w io.Writer, compress bool) *Writer {
+	return &Writer{w: w, compress: compress}
+}
+
+// WriteRecord writes r and returns the number of bytes that hit w.
+func (w *Writer) WriteRecord(r *Record) (int64, error) {
+	var buf bytes.Buffer
+	buf.WriteString(version + "\r\n")
+	keys := make([]string, 0, len(r.Header))
+	for key := range r.Header {
+		if key != "Content-Length" {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		for _, value := range r.Header[key] {
+			buf.WriteString(fieldName(key) + ": " + value + "\r\n")
+		}
+	}
+	buf.WriteString("Content-Length: " + strconv.Itoa(len(r.Block)) + "\r\n\r\n")
+	buf.Write(r.Block)
+	buf.WriteString("\r\n\r\n")
+
+	if !w.compress {
+		n, err := w.w.Write(buf.Bytes())
+		return int64(n), err
+	}
+
+	counter := &countingWriter{w: w.w}
+	gz := gzip.NewWriter(counter)
+	_, err := gz.Write(buf.Bytes())
+	if err == nil {
+		err = gz.Close()
+	}
+	return counter.n, err
+}
+
+// fieldName undoes the MIME canonicalization of the WARC field names, e.g.
+// Warc-Record-Id back to WARC-Record-ID. Readers have to ignore case, but
+// not all of them do.
+func fieldName(key string) string {
+	if !strings.HasPrefix(key, "Warc-") {
+		return key
+	}
+	parts := strings.Split(key, "-")
+	for i, part := range parts {
+		switch part {
+		case "Warc", "Id", "Uri", "Ip":
+			parts[i] = strings.ToUpper(part)
+		}
+	}
+	return strings.Join(parts, "-")
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// Reader reads records from a WARC file, gzipped or not.
+type Reader struct {
+	r *bufio.Reader
+}
+
+// NewReader detects whether r is gzipped from its first bytes.
+func NewReader(r io.Reader) (*Reader, error) {
+	br := bufio.NewReader(r)
+	magic, err := br.Peek(2)
+	if err != nil && err != io.EOF {
+		return nil, fmt.Errorf("cant read warc file: %v", err)
+	}
+	if len(magic) == 2 && magic[0] == 0x1f && magic[1] == 0x8b {
+		gz, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, fmt.Errorf("cant read warc file: %v", err)
+		}
+		br = bufio.NewReader(gz)
+	}
+
+	return &Reader{r: br}, nil
+}
+
+// ReadRecord returns the next record, or io.EOF after the last one.
+func (r *Reader) ReadRecord() (*Record, error) {
+	var line string
+	var err error
+	// skip the blank lines between records
+	for line == "" {
+		line, err = r.r.ReadString('\n')
+		if err == io.EOF && strings.TrimSpace(line) == "" {
+			return nil, io.EOF
+		}
+		if err != nil {
+			return nil, fmt.Errorf("cant read warc record: %v", err)
+		}
+		line = strings.TrimRight(line, "\r\n")
+	}
+	if !strings.HasPrefix(line, "WARC/") {
+		return nil, fmt.Errorf("cant read warc record: unexpected version line %q", line)
+	}
+
+	header, err := textproto.NewReader(r.r).ReadMIMEHeader()
+	if err != nil {
+		return nil, fmt.Errorf("cant read warc header: %v", err)
+	}
+	length, err := strconv.ParseInt(header.Get("Content-Length"), 10, 64)
+	if err != nil || length < 0 {
+		return nil, errors.New("cant read warc record: bad Content-Length")
+	}
+	block := make([]byte, length)
+	_, err = io.ReadFull(r.r, block)
+	if err != nil {
+		return nil, fmt.Errorf("cant read warc block: %v", err)
+	}
+
+	return &Record{Header: header, Block: block}, nil
+}
+
+// FileWriter writes records to gzipped WARC files in a directory, starting a
+// new file once the current one grows past maxSize. It is safe for
+// concurrent use.
+type FileWriter struct {
+	dir     string
+	prefix  string
+	maxSize int64
+
+	mu     sync.Mutex
+	file   *os.File
+	writer *Writer
+	size   int64
+	serial int
+}
+
+func NewFileWriter(dir, prefix string, maxSize int64) *FileWriter {
+	return &FileWriter{dir: dir, prefix: prefix, maxSize: maxSize}
+}
+
+// WriteRecords writes records to the same file, back to back.
+func (f *FileWriter) WriteRecords(records ...*Record) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.file == nil || (f.maxSize > 0 && f.size >= f.maxSize) {
+		err := f.rotate()
+		if err != nil {
+			return err
+		}
+	}
+	for _, record := range records {
+		n, err := f.writer.WriteRecord(record)
+		f.size += n
+		if err != nil {
+			return fmt.Errorf("cant write warc record: %v", err)
+		}
+	}
+
+	return nil
+}
+
+func (f *FileWriter) rotate() error {
+	err := f.close()
+	if err != nil {
+		return err
+	}
+
+	f.serial++
+	name := fmt.Sprintf("%s-%s-%05d.warc.gz", f.prefix, time.Now().UTC().Format("20060102150405"), f.serial)
+	file, err := os.OpenFile(filepath.Join(f.dir, name), os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("cant create warc file: %v", err)
+	}
+	f.file, f.writer, f.size = file, NewWriter(file, true), 0
+
+	info := NewRecord(TypeWarcinfo, "", "application/warc-fields",
+		[]byte("software: oidscraper\r\nformat: WARC File Format 1.1\r\n"))
+	info.Header.Set("WARC-Filename", name)
+	n, err := f.writer.WriteRecord(info)
+	f.size += n
+	if err != nil {
+		return fmt.Errorf("cant write warcinfo record: %v", err)
+	}
+
+	return nil
+}
+
+// Close closes the current file.
+func (f *FileWriter) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.close()
+}
+
+func (f *FileWriter) close() error {
+	if f.file == nil {
+		return nil
+	}
+	err := f.file.Close()
+	f.file, f.writer = nil, nil
+	if err != nil {
+		return fmt.Errorf("cant close warc file: %v", err)
+	}
+	return nil
+}
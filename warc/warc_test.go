@@ -0,0 +1,85 @@
+package warc
+
+import (
+	"bytes"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestWriter_RoundTrip(t *testing.T) {
+	for _, compress := range []bool{false, true} {
+		var buf bytes.Buffer
+		w := NewWriter(&buf, compress)
+		first := NewRecord(TypeRequest, "https://oidref.com/1", "application/http;msgtype=request",
+			[]byte("GET /1 HTTP/1.1\r\n\r\n"))
+		second := NewRecord(TypeResponse, "https://oidref.com/1", "application/http;msgtype=response",
+			[]byte("HTTP/1.1 200 OK\r\n\r\nhi"))
+		_, err := w.WriteRecord(first)
+		require.NoError(t, err)
+		_, err = w.WriteRecord(second)
+		require.NoError(t, err)
+
+		if !compress {
+			assert.True(t, strings.HasPrefix(buf.String(), "WARC/1.1\r\n"))
+			assert.Contains(t, buf.String(), "WARC-Record-ID: <urn:uuid:")
+			assert.Contains(t, buf.String(), "WARC-Target-URI: https://oidref.com/1\r\n")
+		}
+
+		r, err := NewReader(&buf)
+		require.NoError(t, err)
+		for _, want := range []*Record{first, second} {
+			got, err := r.ReadRecord()
+			require.NoError(t, err)
+			assert.Equal(t, want.Type(), got.Type())
+			assert.Equal(t, want.TargetURI(), got.TargetURI())
+			assert.Equal(t, want.Header.Get("WARC-Record-ID"), got.Header.Get("WARC-Record-ID"))
+			assert.Equal(t, want.Date(), got.Date())
+			assert.Equal(t, want.Block, got.Block)
+		}
+		_, err = r.ReadRecord()
+		assert.Equal(t, io.EOF, err)
+	}
+}
+
+func TestReader_Malformed(t *testing.T) {
+	r, err := NewReader(strings.NewReader("HTTP/1.1 200 OK\r\n\r\n"))
+	require.NoError(t, err)
+	_, err = r.ReadRecord()
+	assert.Error(t, err)
+
+	r, err = NewReader(strings.NewReader("WARC/1.1\r\nWARC-Type: response\r\nContent-Length: 10\r\n\r\nshort"))
+	require.NoError(t, err)
+	_, err = r.ReadRecord()
+	assert.Error(t, err)
+}
+
+func TestFileWriter_Rotates(t *testing.T) {
+	dir := t.TempDir()
+	w := NewFileWriter(dir, "test", 1)
+	for i := 0; i < 3; i++ {
+		require.NoError(t, w.WriteRecords(NewRecord(TypeResponse, "https://oidref.com/1", "", []byte("body"))))
+	}
+	require.NoError(t, w.Close())
+
+	files, err := filepath.Glob(filepath.Join(dir, "test-*.warc.gz"))
+	require.NoError(t, err)
+	require.Len(t, files, 3)
+
+	file, err := os.Open(files[0])
+	require.NoError(t, err)
+	defer file.Close()
+	r, err := NewReader(file)
+	require.NoError(t, err)
+	info, err := r.ReadRecord()
+	require.NoError(t, err)
+	assert.Equal(t, TypeWarcinfo, info.Type())
+	assert.Equal(t, filepath.Base(files[0]), info.Header.Get("WARC-Filename"))
+	record, err := r.ReadRecord()
+	require.NoError(t, err)
+	assert.Equal(t, "body", string(record.Block))
+}